@@ -0,0 +1,109 @@
+package criticmarkup
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	KindAddition     = ast.NewNodeKind("Addition")
+	KindDeletion     = ast.NewNodeKind("Deletion")
+	KindSubstitution = ast.NewNodeKind("Substitution")
+	KindHighlight    = ast.NewNodeKind("Highlight")
+	KindComment      = ast.NewNodeKind("Comment")
+
+	kindSeparator = ast.NewNodeKind("SubstitutionSeparator")
+)
+
+// Addition is an inline node for added text, {++text++}.
+type Addition struct {
+	ast.BaseInline
+}
+
+// Kind implements Node.Kind.
+func (n *Addition) Kind() ast.NodeKind {
+	return KindAddition
+}
+
+// Dump implements Node.Dump.
+func (n *Addition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Deletion is an inline node for deleted text, {--text--}.
+type Deletion struct {
+	ast.BaseInline
+}
+
+// Kind implements Node.Kind.
+func (n *Deletion) Kind() ast.NodeKind {
+	return KindDeletion
+}
+
+// Dump implements Node.Dump.
+func (n *Deletion) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Substitution is an inline node for substituted text, {~~old~>new~~}. Its
+// children are a Deletion with the old text and an Addition with the new
+// text.
+type Substitution struct {
+	ast.BaseInline
+}
+
+// Kind implements Node.Kind.
+func (n *Substitution) Kind() ast.NodeKind {
+	return KindSubstitution
+}
+
+// Dump implements Node.Dump.
+func (n *Substitution) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Highlight is an inline node for highlighted text, {==text==}.
+type Highlight struct {
+	ast.BaseInline
+}
+
+// Kind implements Node.Kind.
+func (n *Highlight) Kind() ast.NodeKind {
+	return KindHighlight
+}
+
+// Dump implements Node.Dump.
+func (n *Highlight) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// Comment is an inline node for a comment, {>>text<<}.
+type Comment struct {
+	ast.BaseInline
+}
+
+// Kind implements Node.Kind.
+func (n *Comment) Kind() ast.NodeKind {
+	return KindComment
+}
+
+// Dump implements Node.Dump.
+func (n *Comment) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// separator is the ~> in a substitution. It only remains in the tree, and
+// is rendered as text, if the substitution is not closed.
+type separator struct {
+	ast.BaseInline
+
+	Segment text.Segment
+}
+
+func (n *separator) Kind() ast.NodeKind {
+	return kindSeparator
+}
+
+func (n *separator) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Segment": string(n.Segment.Value(source))}, nil)
+}
@@ -0,0 +1,306 @@
+// Package criticmarkup is a Goldmark extension for CriticMarkup, a syntax
+// for tracking editorial changes: {++added++}, {--deleted--},
+// {~~old~>new~~}, {==highlighted==} and {>>comment<<}.
+package criticmarkup
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Mode controls how changes are rendered.
+type Mode int
+
+const (
+	// ModeMarkup renders additions, deletions and highlights as ins, del and
+	// mark elements, and comments as spans with the class "critic comment".
+	ModeMarkup Mode = iota
+
+	// ModeAccept renders the document with all changes accepted: added text
+	// is kept, deleted text and comments are removed, and highlighted text
+	// is rendered as normal text.
+	ModeAccept
+
+	// ModeReject renders the document with all changes rejected: deleted
+	// text is kept, added text and comments are removed, and highlighted
+	// text is rendered as normal text.
+	ModeReject
+)
+
+// Config configures the CriticMarkup extension.
+type Config struct {
+	Mode Mode
+}
+
+// New returns a new CriticMarkup extension.
+func New(config Config) goldmark.Extender {
+	return &criticMarkup{
+		conf: config,
+	}
+}
+
+type criticMarkup struct {
+	conf Config
+}
+
+// Extend adds CriticMarkup to the Markdown parser and renderer.
+func (e *criticMarkup) Extend(md goldmark.Markdown) {
+	md.Parser().AddOptions(
+		parser.WithInlineParsers(
+			// Before the emphasis parser and the extras tags, which share
+			// some of the trigger characters.
+			util.Prioritized(&criticMarkupParser{}, 150),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&substitutionTransformer{}, 100),
+		),
+	)
+	md.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(newCriticMarkupHTMLRenderer(e.conf.Mode), 500),
+	))
+}
+
+// markup is a pair of CriticMarkup delimiters.
+type markup struct {
+	open, close []byte
+	processor   *delimiterProcessor
+}
+
+var markups = []markup{
+	{[]byte("{++"), []byte("++}"), &delimiterProcessor{func() ast.Node { return &Addition{} }}},
+	{[]byte("{--"), []byte("--}"), &delimiterProcessor{func() ast.Node { return &Deletion{} }}},
+	{[]byte("{~~"), []byte("~~}"), substitutionProcessor},
+	{[]byte("{=="), []byte("==}"), &delimiterProcessor{func() ast.Node { return &Highlight{} }}},
+	{[]byte("{>>"), []byte("<<}"), &delimiterProcessor{func() ast.Node { return &Comment{} }}},
+}
+
+var (
+	substitutionProcessor = &delimiterProcessor{func() ast.Node { return &Substitution{} }}
+	separatorMarker       = []byte("~>")
+)
+
+// delimiterProcessor matches the opening and closing delimiters of one kind
+// of markup.
+type delimiterProcessor struct {
+	newNode func() ast.Node
+}
+
+// IsDelimiter implements parser.DelimiterProcessor. The delimiters are
+// scanned by criticMarkupParser, not by parser.ScanDelimiter.
+func (p *delimiterProcessor) IsDelimiter(b byte) bool {
+	return false
+}
+
+// CanOpenCloser implements parser.DelimiterProcessor.
+func (p *delimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Processor == p && closer.Processor == p
+}
+
+// OnMatch implements parser.DelimiterProcessor.
+func (p *delimiterProcessor) OnMatch(_ int) ast.Node {
+	return p.newNode()
+}
+
+// delimiterChar is the Char of all CriticMarkup delimiters. It differs from
+// the characters of the emphasis and extras delimiters, whose processors
+// only match delimiters with the same Char.
+const delimiterChar = '{'
+
+type criticMarkupParser struct{}
+
+// Trigger implements parser.InlineParser.
+func (s *criticMarkupParser) Trigger() []byte {
+	return []byte{'{', '+', '-', '~', '=', '<'}
+}
+
+// Parse implements parser.InlineParser. It pushes the delimiters of all
+// markups, which are matched when the paragraph has been parsed, so that a
+// markup can contain other inline Markdown and span several lines.
+func (s *criticMarkupParser) Parse(_ ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	for _, m := range markups {
+		canOpen := bytes.HasPrefix(line, m.open)
+		if !canOpen && !bytes.HasPrefix(line, m.close) {
+			continue
+		}
+		// A length of 2 makes goldmark consume the whole delimiter on a
+		// match; see parser.Delimiter.CalcComsumption.
+		d := parser.NewDelimiter(canOpen, !canOpen, 2, delimiterChar, m.processor)
+		d.Segment = segment.WithStop(segment.Start + len(m.open))
+		block.Advance(len(m.open))
+		pc.PushDelimiter(d)
+		return d
+	}
+	if bytes.HasPrefix(line, separatorMarker) && hasOpener(pc, substitutionProcessor) {
+		n := &separator{Segment: segment.WithStop(segment.Start + len(separatorMarker))}
+		block.Advance(len(separatorMarker))
+		return n
+	}
+	return nil
+}
+
+// hasOpener reports whether an opening delimiter of p is waiting for its
+// closing delimiter.
+func hasOpener(pc parser.Context, p parser.DelimiterProcessor) bool {
+	for d := pc.LastDelimiter(); d != nil; d = d.PreviousDelimiter {
+		if d.CanOpen && d.Processor == p {
+			return true
+		}
+	}
+	return false
+}
+
+// substitutionTransformer splits the children of each substitution at the
+// separator into a deletion and an addition. A substitution without a
+// separator is turned back into text.
+type substitutionTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *substitutionTransformer) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	var substitutions []*Substitution
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if s, ok := n.(*Substitution); ok && entering {
+			substitutions = append(substitutions, s)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, s := range substitutions {
+		var sep ast.Node
+		for c := s.FirstChild(); c != nil; c = c.NextSibling() {
+			if c.Kind() == kindSeparator {
+				sep = c
+				break
+			}
+		}
+		if sep == nil {
+			unwrapSubstitution(s)
+			continue
+		}
+		deletion, addition := &Deletion{}, &Addition{}
+		for c := s.FirstChild(); c != sep; {
+			next := c.NextSibling()
+			deletion.AppendChild(deletion, c)
+			c = next
+		}
+		s.RemoveChild(s, sep)
+		for c := s.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			addition.AppendChild(addition, c)
+			c = next
+		}
+		s.AppendChild(s, deletion)
+		s.AppendChild(s, addition)
+	}
+}
+
+// unwrapSubstitution replaces s with its delimiters and children.
+func unwrapSubstitution(s *Substitution) {
+	parent := s.Parent()
+	parent.InsertBefore(parent, s, ast.NewString([]byte("{~~")))
+	for c := s.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		parent.InsertBefore(parent, s, c)
+		c = next
+	}
+	parent.InsertBefore(parent, s, ast.NewString([]byte("~~}")))
+	parent.RemoveChild(parent, s)
+}
+
+type criticMarkupHTMLRenderer struct {
+	html.Config
+	mode Mode
+}
+
+func newCriticMarkupHTMLRenderer(mode Mode, opts ...html.Option) renderer.NodeRenderer {
+	r := &criticMarkupHTMLRenderer{
+		Config: html.NewConfig(),
+		mode:   mode,
+	}
+	for _, opt := range opts {
+		opt.SetHTMLOption(&r.Config)
+	}
+	return r
+}
+
+// RegisterFuncs registers rendering functions to the given NodeRendererFuncRegisterer.
+func (r *criticMarkupHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAddition, r.renderAddition)
+	reg.Register(KindDeletion, r.renderDeletion)
+	reg.Register(KindSubstitution, r.renderSubstitution)
+	reg.Register(KindHighlight, r.renderHighlight)
+	reg.Register(KindComment, r.renderComment)
+	reg.Register(kindSeparator, r.renderSeparator)
+}
+
+func (r *criticMarkupHTMLRenderer) renderAddition(w util.BufWriter, _ []byte, _ ast.Node, entering bool) (ast.WalkStatus, error) {
+	switch r.mode {
+	case ModeAccept:
+		return ast.WalkContinue, nil
+	case ModeReject:
+		return ast.WalkSkipChildren, nil
+	}
+	return renderElement(w, "ins", "", entering)
+}
+
+func (r *criticMarkupHTMLRenderer) renderDeletion(w util.BufWriter, _ []byte, _ ast.Node, entering bool) (ast.WalkStatus, error) {
+	switch r.mode {
+	case ModeAccept:
+		return ast.WalkSkipChildren, nil
+	case ModeReject:
+		return ast.WalkContinue, nil
+	}
+	return renderElement(w, "del", "", entering)
+}
+
+// renderSubstitution renders nothing itself; its deletion and addition are
+// rendered by their own functions.
+func (r *criticMarkupHTMLRenderer) renderSubstitution(_ util.BufWriter, _ []byte, _ ast.Node, _ bool) (ast.WalkStatus, error) {
+	return ast.WalkContinue, nil
+}
+
+func (r *criticMarkupHTMLRenderer) renderHighlight(w util.BufWriter, _ []byte, _ ast.Node, entering bool) (ast.WalkStatus, error) {
+	if r.mode != ModeMarkup {
+		return ast.WalkContinue, nil
+	}
+	return renderElement(w, "mark", "", entering)
+}
+
+func (r *criticMarkupHTMLRenderer) renderComment(w util.BufWriter, _ []byte, _ ast.Node, entering bool) (ast.WalkStatus, error) {
+	if r.mode != ModeMarkup {
+		return ast.WalkSkipChildren, nil
+	}
+	return renderElement(w, "span", "critic comment", entering)
+}
+
+func (r *criticMarkupHTMLRenderer) renderSeparator(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		r.Writer.Write(w, n.(*separator).Segment.Value(source))
+	}
+	return ast.WalkContinue, nil
+}
+
+// renderElement writes the start or end tag of an element.
+func renderElement(w util.BufWriter, tag, class string, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_ = w.WriteByte('<')
+		_, _ = w.WriteString(tag)
+		if class != "" {
+			_, _ = w.WriteString(` class="`)
+			_, _ = w.WriteString(class)
+			_ = w.WriteByte('"')
+		}
+	} else {
+		_, _ = w.WriteString("</")
+		_, _ = w.WriteString(tag)
+	}
+	_ = w.WriteByte('>')
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,37 @@
+package criticmarkup_test
+
+import (
+	"testing"
+
+	"github.com/gohugoio/hugo-goldmark-extensions/criticmarkup"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/testutil"
+	"github.com/yuin/goldmark/text"
+)
+
+func buildGoldmarkWithCriticMarkup(conf criticmarkup.Config) goldmark.Markdown {
+	return goldmark.New(goldmark.WithExtensions(criticmarkup.New(conf)))
+}
+
+func TestMarkup(t *testing.T) {
+	md := buildGoldmarkWithCriticMarkup(criticmarkup.Config{})
+	testutil.DoTestCaseFile(md, "_test/markup.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func TestAccept(t *testing.T) {
+	md := buildGoldmarkWithCriticMarkup(criticmarkup.Config{Mode: criticmarkup.ModeAccept})
+	testutil.DoTestCaseFile(md, "_test/accept.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func TestReject(t *testing.T) {
+	md := buildGoldmarkWithCriticMarkup(criticmarkup.Config{Mode: criticmarkup.ModeReject})
+	testutil.DoTestCaseFile(md, "_test/reject.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func TestDump(t *testing.T) {
+	input := "{++a++} {--b--} {~~c~>d~~} {==e==}{>>f<<}"
+	md := buildGoldmarkWithCriticMarkup(criticmarkup.Config{})
+	root := md.Parser().Parse(text.NewReader([]byte(input)))
+	root.Dump([]byte(input), 0)
+	// Prints to stdout, so just test that it doesn't crash
+}
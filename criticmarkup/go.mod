@@ -0,0 +1,5 @@
+module github.com/gohugoio/hugo-goldmark-extensions/criticmarkup
+
+go 1.22
+
+require github.com/yuin/goldmark v1.8.2
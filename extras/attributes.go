@@ -0,0 +1,144 @@
+package extras
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// attributeIDTransformer registers the ids of the attribute lists that
+// follow the closing delimiters of tags in a paragraph. The lists are only
+// parsed once the whole document is parsed, after the ids of later headings
+// have been generated, so without this a heading could get the same id.
+type attributeIDTransformer struct {
+	// The delimiter characters of the enabled tags.
+	chars []byte
+}
+
+// Transform implements parser.ParagraphTransformer.
+func (t *attributeIDTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		line := seg.Value(source)
+		for j := 0; j < len(line); j++ {
+			switch {
+			case line[j] == '\\' && j+1 < len(line) && util.IsPunct(line[j+1]):
+				j++
+			case line[j] == '`':
+				j = skipCodeSpan(line, j)
+			case line[j] == '{' && j > 0 && bytes.IndexByte(t.chars, line[j-1]) >= 0:
+				if attrs, ok := parser.ParseAttributes(text.NewReader(line[j:])); ok {
+					putIDs(attrs, pc)
+				}
+			}
+		}
+	}
+}
+
+// putIDs registers the id attribute in attrs, if any, so that generated
+// heading ids don't collide with it.
+func putIDs(attrs parser.Attributes, pc parser.Context) {
+	for _, attr := range attrs {
+		if id, ok := attr.Value.([]byte); ok && string(attr.Name) == "id" {
+			pc.IDs().Put(id)
+		}
+	}
+}
+
+// skipCodeSpan returns the offset of the last backtick of the code span that
+// starts at b[i], or of the last backtick of the opening run if the span is
+// not closed on this line.
+func skipCodeSpan(b []byte, i int) int {
+	n := 0
+	for i+n < len(b) && b[i+n] == '`' {
+		n++
+	}
+	for j := i + n; j < len(b); {
+		if b[j] != '`' {
+			j++
+			continue
+		}
+		m := 0
+		for j+m < len(b) && b[j+m] == '`' {
+			m++
+		}
+		if m == n {
+			return j + m - 1
+		}
+		j += m
+	}
+	return i + n - 1
+}
+
+// inlineTagAttributeTransformer moves an attribute list, such as {.warning},
+// that directly follows the closing delimiter of an inline tag from the text
+// to the tag.
+type inlineTagAttributeTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *inlineTagAttributeTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if tag, ok := n.(*inlineTagNode); ok {
+			parseTagAttributes(tag, source, pc)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// parseTagAttributes parses the attribute list at the start of the text
+// following n, if any, and removes it from the text.
+func parseTagAttributes(n *inlineTagNode, source []byte, pc parser.Context) {
+	first, ok := n.NextSibling().(*ast.Text)
+	if !ok || first.Segment.Len() == 0 || source[first.Segment.Start] != '{' {
+		return
+	}
+
+	// The text may be split into several nodes, e.g. at an = that didn't
+	// start a mark. The attribute list ends at the end of the line.
+	start, stop := first.Segment.Start, first.Segment.Stop
+	for c := first; !c.SoftLineBreak() && !c.HardLineBreak(); {
+		next, ok := c.NextSibling().(*ast.Text)
+		if !ok || next.Segment.Start != stop {
+			break
+		}
+		c, stop = next, next.Segment.Stop
+	}
+
+	r := text.NewReader(source[start:stop])
+	attrs, ok := parser.ParseAttributes(r)
+	if !ok {
+		return
+	}
+	_, pos := r.Position()
+	putIDs(attrs, pc)
+	for _, attr := range attrs {
+		n.SetAttribute(attr.Name, attr.Value)
+	}
+
+	// Remove the attribute list from the text.
+	end := start + pos.Start
+	for c := ast.Node(first); c != nil; {
+		t := c.(*ast.Text)
+		next := c.NextSibling()
+		if t.Segment.Stop > end {
+			t.Segment = t.Segment.WithStart(end)
+			break
+		}
+		if t.SoftLineBreak() || t.HardLineBreak() {
+			// Keep the line break.
+			t.Segment = t.Segment.WithStart(t.Segment.Stop)
+			break
+		}
+		c.Parent().RemoveChild(c.Parent(), c)
+		c = next
+	}
+}
@@ -0,0 +1,147 @@
+package extras
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// Default priorities of custom tags with zero priorities. Parsing runs before
+// the emphasis parser, so that e.g. __text__ can be a custom tag.
+const (
+	defaultCustomParsePriority  = 450
+	defaultCustomRenderPriority = 500
+)
+
+var (
+	customKindsMu sync.Mutex
+	customKinds   = make(map[string]ast.NodeKind)
+)
+
+// customTagKind returns the NodeKind of a custom tag with a zero TagKind.
+// NodeKinds are global, so the kind is allocated once and then shared by all
+// tags with the same delimiter and element.
+func customTagKind(tag InlineTag) ast.NodeKind {
+	key := tag.delimiter() + tag.Html
+	customKindsMu.Lock()
+	defer customKindsMu.Unlock()
+	kind, ok := customKinds[key]
+	if !ok {
+		kind = ast.NewNodeKind(strings.ToUpper(tag.Html[:1]) + tag.Html[1:])
+		customKinds[key] = kind
+	}
+	return kind
+}
+
+// delimiter returns the delimiter of the tag, e.g. "==".
+func (tag InlineTag) delimiter() string {
+	return strings.Repeat(string(tag.Char), tag.Number)
+}
+
+// Resolved returns tag with its zero fields set to the defaults used for
+// custom tags, including the NodeKind allocated for a zero TagKind. Pass the
+// resolved tag to e.g. NewInlineTagMarkdownRenderer to get the kind of the
+// nodes the extension creates for a custom tag.
+func (tag InlineTag) Resolved() InlineTag {
+	if tag.TagKind == 0 {
+		tag.TagKind = customTagKind(tag)
+	}
+	if tag.ParsePriority == 0 {
+		tag.ParsePriority = defaultCustomParsePriority
+	}
+	if tag.RenderPriority == 0 {
+		tag.RenderPriority = defaultCustomRenderPriority
+	}
+	return tag
+}
+
+// enabledTags returns the built-in tags enabled in c.
+func (c Config) enabledTags() []InlineTag {
+	var tags []InlineTag
+	if c.Superscript.Enable {
+		tags = append(tags, SuperscriptTag)
+	}
+	if c.Subscript.Enable {
+		tags = append(tags, SubscriptTag)
+	}
+	if c.Insert.Enable {
+		tags = append(tags, InsertTag)
+	}
+	if c.Mark.Enable {
+		tags = append(tags, MarkTag)
+	}
+	if c.Delete.Enable {
+		tags = append(tags, DeleteTag)
+	}
+	return tags
+}
+
+// Validate reports an error if a custom tag in c is invalid or uses the same
+// delimiter as an enabled built-in tag or another custom tag. Such tags are
+// skipped by the extension.
+func (c Config) Validate() error {
+	_, err := c.customTags()
+	return err
+}
+
+// customTags returns the valid custom tags in c, and an error for the first
+// invalid one, if any. A tag whose delimiter is already used by an enabled
+// built-in tag or an earlier custom tag is invalid.
+func (c Config) customTags() ([]InlineTag, error) {
+	used := make(map[string]string)
+	for _, tag := range c.enabledTags() {
+		used[tag.delimiter()] = tag.Html
+	}
+	var tags []InlineTag
+	var first error
+	for _, tag := range c.Custom {
+		if err := validateCustomTag(tag, used); err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		used[tag.delimiter()] = tag.Html
+		tags = append(tags, tag)
+	}
+	return tags, first
+}
+
+// validateCustomTag reports an error if tag is invalid or its delimiter is
+// in used.
+func validateCustomTag(tag InlineTag, used map[string]string) error {
+	if tag.Number != 1 && tag.Number != 2 {
+		return fmt.Errorf("extras: custom tag %q: Number must be 1 or 2", tag.Html)
+	}
+	if !util.IsPunct(tag.Char) {
+		return fmt.Errorf("extras: custom tag %q: Char must be ASCII punctuation", tag.Html)
+	}
+	if !isElementName(tag.Html) {
+		return fmt.Errorf("extras: custom tag %q: invalid HTML element name", tag.Html)
+	}
+	for _, kind := range []ast.NodeKind{KindSuperscript, KindSubscript, KindInsert, KindMark, KindDelete} {
+		if tag.TagKind == kind {
+			return fmt.Errorf("extras: custom tag %q: TagKind %s is used by a built-in tag", tag.Html, kind)
+		}
+	}
+	d := tag.delimiter()
+	if other, ok := used[d]; ok {
+		return fmt.Errorf("extras: custom tag %q: delimiter %q is already used by %q", tag.Html, d, other)
+	}
+	return nil
+}
+
+func isElementName(s string) bool {
+	if s == "" || !util.IsAlphaNumeric(s[0]) || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !util.IsAlphaNumeric(s[i]) && s[i] != '-' {
+			return false
+		}
+	}
+	return true
+}
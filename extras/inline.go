@@ -24,8 +24,12 @@ func (p *inlineTagDelimiterProcessor) IsDelimiter(b byte) bool {
 	return b == p.Char
 }
 
+// CanOpenCloser reports whether closer is a run of the same length scanned
+// for the same tag, so that runs of the same character scanned by emphasis
+// or by another tag, e.g. _ and __, don't close each other.
 func (p *inlineTagDelimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
-	return opener.Char == closer.Char
+	c, ok := closer.Processor.(*inlineTagDelimiterProcessor)
+	return ok && c.TagKind == p.TagKind && opener.OriginalLength == closer.OriginalLength
 }
 
 func (p *inlineTagDelimiterProcessor) OnMatch(_ int) ast.Node {
@@ -34,10 +38,13 @@ func (p *inlineTagDelimiterProcessor) OnMatch(_ int) ast.Node {
 
 type inlineTagParser struct {
 	InlineTag
+
+	// strict enforces Pandoc's rules for superscripts and subscripts.
+	strict bool
 }
 
-func newInlineTagParser(tag InlineTag) parser.InlineParser {
-	return &inlineTagParser{InlineTag: tag}
+func newInlineTagParser(tag InlineTag, strict bool) parser.InlineParser {
+	return &inlineTagParser{InlineTag: tag, strict: strict}
 }
 
 // Trigger implements parser.InlineParser.
@@ -63,23 +70,64 @@ func (s *inlineTagParser) Parse(_ ast.Node, block text.Reader, pc parser.Context
 	if node == nil || node.OriginalLength > 2 || before == rune(s.Char) {
 		return nil
 	}
+	if s.strict {
+		// A longer run would nest tags of the same kind.
+		if node.OriginalLength != s.Number {
+			return nil
+		}
+		if node.CanOpen && !s.closesBeforeSpace(line[node.OriginalLength:]) {
+			node.CanOpen = false
+		}
+		if !node.CanOpen && !node.CanClose {
+			return nil
+		}
+	}
+	// Other processors, such as emphasis, match delimiters by their Char
+	// alone; clear it so that they don't take this run for one of theirs.
+	node.Char = 0
 	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
 	block.Advance(node.OriginalLength)
 	pc.PushDelimiter(node)
 	return node
 }
 
+// closesBeforeSpace reports whether b, the rest of the line after an opening
+// delimiter, has a closing delimiter before any whitespace that is not
+// escaped with a backslash.
+func (s *inlineTagParser) closesBeforeSpace(b []byte) bool {
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '\\' && i+1 < len(b) && b[i+1] != '\n':
+			i++
+		case util.IsSpace(b[i]):
+			return false
+		case b[i] == s.Char:
+			return i > 0
+		}
+	}
+	return false
+}
+
 type inlineTagHTMLRenderer struct {
 	htmlTag string
 	tagKind ast.NodeKind
+	unicode bool
 	html.Config
 }
 
 // NewInlineTagHTMLRenderer returns a new NodeRenderer that renders Inline nodes to HTML.
 func NewInlineTagHTMLRenderer(tag InlineTag, opts ...html.Option) renderer.NodeRenderer {
+	return newInlineTagHTMLRenderer(tag, false, opts...)
+}
+
+// newInlineTagHTMLRenderer returns a new NodeRenderer that renders Inline
+// nodes to HTML. If unicode is set, superscripts and subscripts are rendered
+// with Unicode characters when possible.
+func newInlineTagHTMLRenderer(tag InlineTag, unicode bool, opts ...html.Option) renderer.NodeRenderer {
 	r := &inlineTagHTMLRenderer{
 		htmlTag: tag.Html,
 		tagKind: tag.TagKind,
+		unicode: unicode,
 		Config:  html.NewConfig(),
 	}
 	for _, opt := range opts {
@@ -96,15 +144,34 @@ func (r *inlineTagHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegis
 // inlineTagAttributeFilter is a global filter for attributes.
 var inlineTagAttributeFilter = html.GlobalAttributeFilter
 
+// editAttributeFilter adds the attributes of the ins and del elements.
+var editAttributeFilter = inlineTagAttributeFilter.Extend(
+	[]byte("cite"),
+	[]byte("datetime"),
+)
+
 // renderInlineTag renders an inline tag.
 func (r *inlineTagHTMLRenderer) renderInlineTag(
-	w util.BufWriter, _ []byte, n ast.Node, entering bool,
+	w util.BufWriter, source []byte, n ast.Node, entering bool,
 ) (ast.WalkStatus, error) {
+	if r.unicode && n.Attributes() == nil {
+		// Without an element, the exit call writes nothing.
+		if b, ok := toUnicodeScript(n, source, unicodeScripts(r.tagKind)); ok {
+			if entering {
+				_, _ = w.Write(b)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+	}
 	if entering {
 		_ = w.WriteByte('<')
 		_, _ = w.WriteString(r.htmlTag)
 		if n.Attributes() != nil {
-			html.RenderAttributes(w, n, inlineTagAttributeFilter)
+			filter := inlineTagAttributeFilter
+			if r.htmlTag == "ins" || r.htmlTag == "del" {
+				filter = editAttributeFilter
+			}
+			html.RenderAttributes(w, n, filter)
 		}
 	} else {
 		_, _ = w.WriteString("</")
@@ -126,16 +193,44 @@ type Config struct {
 	Insert      InsertConfig
 	Mark        MarkConfig
 	Delete      DeleteConfig
+
+	// Custom holds user-defined inline tags, e.g. !!text!! rendered as a
+	// small element. A tag with a zero TagKind is given a NodeKind of its
+	// own, and zero priorities are given defaults that parse before
+	// emphasis. See Validate for the restrictions on custom tags.
+	Custom []InlineTag
+
+	// Attributes enables attribute lists, such as {.warning}, directly after
+	// the closing delimiter of a tag, e.g. ==important=={.warning}.
+	Attributes bool
 }
 
 // SuperscriptConfig configures the superscript extension.
 type SuperscriptConfig struct {
 	Enable bool
+
+	// Strict enforces Pandoc's rules: a superscript must not contain
+	// whitespace unless it is escaped with a backslash, in which case it is
+	// rendered as a no-break space, and superscripts can't be nested.
+	Strict bool
+
+	// Unicode renders superscripts with Unicode superscript characters, e.g.
+	// x², instead of a sup element when all of their text has one.
+	Unicode bool
 }
 
 // SubscriptConfig configures the subscript extension.
 type SubscriptConfig struct {
 	Enable bool
+
+	// Strict enforces Pandoc's rules: a subscript must not contain whitespace
+	// unless it is escaped with a backslash, in which case it is rendered as
+	// a no-break space, and subscripts can't be nested.
+	Strict bool
+
+	// Unicode renders subscripts with Unicode subscript characters, e.g. H₂O,
+	// instead of a sub element when all of their text has one.
+	Unicode bool
 }
 
 // InsertConfig configures the insert extension.
@@ -152,8 +247,8 @@ type DeleteConfig struct {
 	Enable bool
 }
 
-// New returns a new inline tag extension.
-
+// New returns a new inline tag extension. Invalid custom tags are skipped;
+// use Config.Validate to report them.
 func New(config Config) goldmark.Extender {
 	return &inlineExtension{
 		conf: config,
@@ -162,27 +257,49 @@ func New(config Config) goldmark.Extender {
 
 // Extend adds inline tags to the Markdown parser and renderer.
 func (tag *inlineExtension) Extend(md goldmark.Markdown) {
-	addTag := func(tag InlineTag) {
+	var strictKinds []ast.NodeKind
+	var chars []byte
+	addTag := func(tag InlineTag, unicode, strict bool) {
+		chars = append(chars, tag.Char)
 		md.Parser().AddOptions(parser.WithInlineParsers(
-			util.Prioritized(newInlineTagParser(tag), tag.ParsePriority),
+			util.Prioritized(newInlineTagParser(tag, strict), tag.ParsePriority),
 		))
 		md.Renderer().AddOptions(renderer.WithNodeRenderers(
-			util.Prioritized(NewInlineTagHTMLRenderer(tag), tag.RenderPriority),
+			util.Prioritized(newInlineTagHTMLRenderer(tag, unicode), tag.RenderPriority),
 		))
+		if strict {
+			strictKinds = append(strictKinds, tag.TagKind)
+		}
 	}
 	if tag.conf.Superscript.Enable {
-		addTag(SuperscriptTag)
+		addTag(SuperscriptTag, tag.conf.Superscript.Unicode, tag.conf.Superscript.Strict)
 	}
 	if tag.conf.Subscript.Enable {
-		addTag(SubscriptTag)
+		addTag(SubscriptTag, tag.conf.Subscript.Unicode, tag.conf.Subscript.Strict)
 	}
 	if tag.conf.Insert.Enable {
-		addTag(InsertTag)
+		addTag(InsertTag, false, false)
 	}
 	if tag.conf.Mark.Enable {
-		addTag(MarkTag)
+		addTag(MarkTag, false, false)
 	}
 	if tag.conf.Delete.Enable {
-		addTag(DeleteTag)
+		addTag(DeleteTag, false, false)
+	}
+	customTags, _ := tag.conf.customTags()
+	for _, custom := range customTags {
+		addTag(custom.Resolved(), false, false)
+	}
+	if len(strictKinds) > 0 {
+		md.Parser().AddOptions(parser.WithASTTransformers(
+			util.Prioritized(&escapedSpaceTransformer{kinds: strictKinds}, 100),
+		))
+	}
+	if tag.conf.Attributes {
+		md.Parser().AddOptions(parser.WithASTTransformers(
+			util.Prioritized(&inlineTagAttributeTransformer{}, 100),
+		), parser.WithParagraphTransformers(
+			util.Prioritized(&attributeIDTransformer{chars: chars}, 300),
+		))
 	}
 }
@@ -5,7 +5,11 @@ import (
 	"testing"
 
 	"github.com/gohugoio/hugo-goldmark-extensions/extras"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/testutil"
@@ -70,6 +74,14 @@ func TestSubscript(t *testing.T) {
 	testutil.DoTestCaseFile(markdownWithDeleteAndSubscript, "_test/subscript.txt", t, testutil.ParseCliCaseArg()...)
 }
 
+func TestUnicode(t *testing.T) {
+	md := buildGoldmarkWithInlineTag(extras.Config{
+		Superscript: extras.SuperscriptConfig{Enable: true, Unicode: true},
+		Subscript:   extras.SubscriptConfig{Enable: true, Unicode: true},
+	})
+	testutil.DoTestCaseFile(md, "_test/unicode.txt", t, testutil.ParseCliCaseArg()...)
+}
+
 func TestSubscriptDump(t *testing.T) {
 	input := "The H~2~O molecule"
 	root := markdownWithSubscript.Parser().Parse(text.NewReader([]byte(input)))
@@ -215,3 +227,240 @@ Delete some text: ~~deleted~~. Amazing.`
 		}
 	})
 }
+
+// coreTestRenderer renders the core nodes used in the Markdown and plain
+// text tests.
+type coreTestRenderer struct{}
+
+func (r coreTestRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindDocument, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		return ast.WalkContinue, nil
+	})
+	reg.Register(ast.KindParagraph, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			_ = w.WriteByte('\n')
+		}
+		return ast.WalkContinue, nil
+	})
+	reg.Register(ast.KindText, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.Write(n.(*ast.Text).Segment.Value(source))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	tags := []extras.InlineTag{extras.SuperscriptTag, extras.SubscriptTag, extras.InsertTag, extras.MarkTag, extras.DeleteTag}
+	renderers := []util.PrioritizedValue{util.Prioritized(coreTestRenderer{}, 1000)}
+	for _, tag := range tags {
+		renderers = append(renderers, util.Prioritized(extras.NewInlineTagMarkdownRenderer(tag), 10))
+	}
+	md := goldmark.New(
+		goldmark.WithExtensions(extras.New(extras.Config{
+			Superscript: extras.SuperscriptConfig{Enable: true},
+			Subscript:   extras.SubscriptConfig{Enable: true},
+			Insert:      extras.InsertConfig{Enable: true},
+			Mark:        extras.MarkConfig{Enable: true},
+			Delete:      extras.DeleteConfig{Enable: true},
+			Attributes:  true,
+		})),
+		goldmark.WithRenderer(renderer.NewRenderer(renderer.WithNodeRenderers(renderers...))),
+	)
+	testutil.DoTestCaseFile(md, "_test/markdown.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func buildGoldmarkWithPlainText(c extras.PlainTextConfig) goldmark.Markdown {
+	tags := []extras.InlineTag{extras.SuperscriptTag, extras.SubscriptTag, extras.InsertTag, extras.MarkTag, extras.DeleteTag}
+	renderers := []util.PrioritizedValue{util.Prioritized(coreTestRenderer{}, 1000)}
+	for _, tag := range tags {
+		renderers = append(renderers, util.Prioritized(extras.NewInlineTagPlainTextRenderer(tag, c), 10))
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(extras.New(extras.Config{
+			Superscript: extras.SuperscriptConfig{Enable: true},
+			Subscript:   extras.SubscriptConfig{Enable: true},
+			Insert:      extras.InsertConfig{Enable: true},
+			Mark:        extras.MarkConfig{Enable: true},
+			Delete:      extras.DeleteConfig{Enable: true},
+		})),
+		goldmark.WithRenderer(renderer.NewRenderer(renderer.WithNodeRenderers(renderers...))),
+	)
+}
+
+func TestPlainTextRenderer(t *testing.T) {
+	md := buildGoldmarkWithPlainText(extras.PlainTextConfig{})
+	testutil.DoTestCaseFile(md, "_test/plaintext.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func TestPlainTextRendererUnicode(t *testing.T) {
+	md := buildGoldmarkWithPlainText(extras.PlainTextConfig{Unicode: true})
+	testutil.DoTestCaseFile(md, "_test/plaintext_unicode.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+var customTags = []extras.InlineTag{
+	{Char: '!', Number: 2, Html: "small"},
+	{Char: '?', Number: 2, Html: "cite"},
+	{Char: '_', Number: 2, Html: "u"},
+}
+
+func TestCustom(t *testing.T) {
+	md := buildGoldmarkWithInlineTag(extras.Config{
+		Superscript: extras.SuperscriptConfig{Enable: true},
+		Mark:        extras.MarkConfig{Enable: true},
+		Custom:      customTags,
+	})
+	testutil.DoTestCaseFile(md, "_test/custom.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func TestCustomKind(t *testing.T) {
+	md := buildGoldmarkWithInlineTag(extras.Config{Custom: customTags})
+	input := "!!a!! ??b?? !!c!!"
+	root := md.Parser().Parse(text.NewReader([]byte(input)))
+	p := root.FirstChild()
+	small, cite, small2 := p.FirstChild(), p.FirstChild().NextSibling().NextSibling(), p.LastChild()
+	if small.Kind() == cite.Kind() {
+		t.Errorf("custom tags share the kind %s", small.Kind())
+	}
+	if small.Kind() != small2.Kind() {
+		t.Errorf("got kinds %s and %s for the same custom tag", small.Kind(), small2.Kind())
+	}
+	if got := small.Kind().String(); got != "Small" {
+		t.Errorf("got kind name %q, want %q", got, "Small")
+	}
+
+	// A second extension gets the same kinds.
+	md2 := buildGoldmarkWithInlineTag(extras.Config{Custom: customTags})
+	root2 := md2.Parser().Parse(text.NewReader([]byte(input)))
+	if got := root2.FirstChild().FirstChild().Kind(); got != small.Kind() {
+		t.Errorf("got kind %d, want %d", got, small.Kind())
+	}
+}
+
+func TestCustomRenderers(t *testing.T) {
+	input := "!!a!! and ??b??"
+	md := buildGoldmarkWithInlineTag(extras.Config{Custom: customTags})
+	root := md.Parser().Parse(text.NewReader([]byte(input)))
+	if got, want := root.FirstChild().FirstChild().Kind(), customTags[0].Resolved().TagKind; got != want {
+		t.Errorf("got kind %s, want resolved kind %s", got, want)
+	}
+
+	for _, test := range []struct {
+		name     string
+		renderer func(tag extras.InlineTag) renderer.NodeRenderer
+		expected string
+	}{
+		{
+			"markdown",
+			extras.NewInlineTagMarkdownRenderer,
+			"!!a!! and ??b??\n",
+		},
+		{
+			"plain text",
+			func(tag extras.InlineTag) renderer.NodeRenderer {
+				return extras.NewInlineTagPlainTextRenderer(tag, extras.PlainTextConfig{})
+			},
+			"a and b\n",
+		},
+	} {
+		renderers := []util.PrioritizedValue{util.Prioritized(coreTestRenderer{}, 1000)}
+		for _, tag := range customTags {
+			renderers = append(renderers, util.Prioritized(test.renderer(tag), 10))
+		}
+		md := goldmark.New(
+			goldmark.WithExtensions(extras.New(extras.Config{Custom: customTags})),
+			goldmark.WithRenderer(renderer.NewRenderer(renderer.WithNodeRenderers(renderers...))),
+		)
+		var buf bytes.Buffer
+		if err := md.Convert([]byte(input), &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.expected {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestCustomValidate(t *testing.T) {
+	for _, test := range []struct {
+		conf extras.Config
+		err  string
+	}{
+		{extras.Config{Custom: customTags}, ""},
+		{extras.Config{Custom: []extras.InlineTag{{Char: '~', Number: 1, Html: "s"}}}, ""},
+		{
+			extras.Config{Subscript: extras.SubscriptConfig{Enable: true}, Custom: []extras.InlineTag{{Char: '~', Number: 1, Html: "s"}}},
+			`extras: custom tag "s": delimiter "~" is already used by "sub"`,
+		},
+		{
+			extras.Config{Custom: []extras.InlineTag{{Char: '!', Number: 2, Html: "small"}, {Char: '!', Number: 2, Html: "big"}}},
+			`extras: custom tag "big": delimiter "!!" is already used by "small"`,
+		},
+		{extras.Config{Custom: []extras.InlineTag{{Char: '!', Number: 3, Html: "small"}}}, `extras: custom tag "small": Number must be 1 or 2`},
+		{extras.Config{Custom: []extras.InlineTag{{Char: 'a', Number: 2, Html: "small"}}}, `extras: custom tag "small": Char must be ASCII punctuation`},
+		{extras.Config{Custom: []extras.InlineTag{{Char: '!', Number: 2, Html: "<b>"}}}, `extras: custom tag "<b>": invalid HTML element name`},
+		{extras.Config{Custom: []extras.InlineTag{{Char: '!', Number: 2, Html: "b", TagKind: extras.KindMark}}}, `extras: custom tag "b": TagKind Mark is used by a built-in tag`},
+	} {
+		err := test.conf.Validate()
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.err {
+			t.Errorf("got error %q, want %q", got, test.err)
+		}
+	}
+
+	// Invalid tags are skipped, the others are added.
+	md := buildGoldmarkWithInlineTag(extras.Config{Custom: []extras.InlineTag{
+		{Char: '!', Number: 3, Html: "small"},
+		{Char: '?', Number: 2, Html: "cite"},
+		{Char: '?', Number: 2, Html: "q"},
+	}})
+	var buf bytes.Buffer
+	if err := md.Convert([]byte("!!!a!!! ??b??"), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "<p>!!!a!!! <cite>b</cite></p>\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	md := buildGoldmarkWithInlineTag(extras.Config{
+		Superscript: extras.SuperscriptConfig{Enable: true},
+		Subscript:   extras.SubscriptConfig{Enable: true, Unicode: true},
+		Insert:      extras.InsertConfig{Enable: true},
+		Mark:        extras.MarkConfig{Enable: true},
+		Delete:      extras.DeleteConfig{Enable: true},
+		Attributes:  true,
+	})
+	testutil.DoTestCaseFile(md, "_test/attributes.txt", t, testutil.ParseCliCaseArg()...)
+}
+
+func TestAttributesHeadingID(t *testing.T) {
+	md := goldmark.New(
+		goldmark.WithExtensions(extras.New(extras.Config{
+			Mark:       extras.MarkConfig{Enable: true},
+			Attributes: true,
+		})),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+	var buf bytes.Buffer
+	if err := md.Convert([]byte("==a=={#h} and `=={#code}`\n\n# h\n\n# code"), &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "<p><mark id=\"h\">a</mark> and <code>=={#code}</code></p>\n<h1 id=\"h-1\">h</h1>\n<h1 id=\"code\">code</h1>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	md := buildGoldmarkWithInlineTag(extras.Config{
+		Superscript: extras.SuperscriptConfig{Enable: true, Strict: true},
+		Subscript:   extras.SubscriptConfig{Enable: true, Strict: true},
+		Delete:      extras.DeleteConfig{Enable: true},
+	})
+	testutil.DoTestCaseFile(md, "_test/strict.txt", t, testutil.ParseCliCaseArg()...)
+}
@@ -0,0 +1,107 @@
+package extras
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+type inlineTagMarkdownRenderer struct {
+	tagKind ast.NodeKind
+}
+
+// NewInlineTagMarkdownRenderer returns a new NodeRenderer that renders Inline
+// nodes back to Markdown, surrounding their content with the original
+// delimiters. A zero TagKind is resolved as by InlineTag.Resolved.
+func NewInlineTagMarkdownRenderer(tag InlineTag) renderer.NodeRenderer {
+	return &inlineTagMarkdownRenderer{
+		tagKind: tag.Resolved().TagKind,
+	}
+}
+
+// RegisterFuncs registers rendering functions to the given NodeRendererFuncRegisterer.
+func (r *inlineTagMarkdownRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(r.tagKind, r.renderInlineTag)
+}
+
+// renderInlineTag renders an inline tag as its delimiters around its content,
+// followed by its attribute list, if any.
+func (r *inlineTagMarkdownRenderer) renderInlineTag(
+	w util.BufWriter, _ []byte, n ast.Node, entering bool,
+) (ast.WalkStatus, error) {
+	tag := n.(*inlineTagNode)
+	for i := 0; i < tag.Number; i++ {
+		_ = w.WriteByte(tag.Char)
+	}
+	if !entering && n.Attributes() != nil {
+		writeMarkdownAttributes(w, n)
+	}
+	return ast.WalkContinue, nil
+}
+
+// writeMarkdownAttributes writes the attributes of n as an attribute list,
+// e.g. {#id .class key="value"}, as written after a closing delimiter.
+func writeMarkdownAttributes(w util.BufWriter, n ast.Node) {
+	_ = w.WriteByte('{')
+	for i, attr := range n.Attributes() {
+		if i > 0 {
+			_ = w.WriteByte(' ')
+		}
+		value, ok := attr.Value.([]byte)
+		if !ok {
+			_, _ = w.Write(attr.Name)
+			_ = w.WriteByte('=')
+			writeMarkdownAttributeValue(w, attr.Value)
+			continue
+		}
+		switch string(attr.Name) {
+		case "id":
+			_ = w.WriteByte('#')
+			_, _ = w.Write(value)
+		case "class":
+			for j, class := range bytes.Fields(value) {
+				if j > 0 {
+					_ = w.WriteByte(' ')
+				}
+				_ = w.WriteByte('.')
+				_, _ = w.Write(class)
+			}
+		default:
+			_, _ = w.Write(attr.Name)
+			_ = w.WriteByte('=')
+			writeMarkdownAttributeValue(w, value)
+		}
+	}
+	_ = w.WriteByte('}')
+}
+
+// writeMarkdownAttributeValue writes an attribute value as parsed by
+// parser.ParseAttributes: strings are quoted, numbers, booleans and null are
+// written as is, and arrays are written as [a, b].
+func writeMarkdownAttributeValue(w util.BufWriter, v any) {
+	switch v := v.(type) {
+	case []byte:
+		_, _ = w.WriteString(strconv.Quote(string(v)))
+	case []any:
+		_ = w.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				_, _ = w.WriteString(", ")
+			}
+			writeMarkdownAttributeValue(w, e)
+		}
+		_ = w.WriteByte(']')
+	case float64:
+		_, _ = w.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		_, _ = w.WriteString(strconv.FormatBool(v))
+	case nil:
+		_, _ = w.WriteString("null")
+	default:
+		_, _ = w.WriteString(strconv.Quote(fmt.Sprint(v)))
+	}
+}
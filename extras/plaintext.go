@@ -0,0 +1,48 @@
+package extras
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// PlainTextConfig configures the plain text renderers.
+type PlainTextConfig struct {
+	// Unicode renders superscripts and subscripts with Unicode superscript
+	// and subscript characters, e.g. x² and H₂O, when all of their text has
+	// such a character.
+	Unicode bool
+}
+
+type inlineTagPlainTextRenderer struct {
+	tagKind ast.NodeKind
+	PlainTextConfig
+}
+
+// NewInlineTagPlainTextRenderer returns a new NodeRenderer that renders Inline
+// nodes as plain text, e.g. for search indexes and summaries. Only the text
+// content of the node is written. A zero TagKind is resolved as by InlineTag.Resolved.
+func NewInlineTagPlainTextRenderer(tag InlineTag, c PlainTextConfig) renderer.NodeRenderer {
+	return &inlineTagPlainTextRenderer{
+		tagKind:         tag.Resolved().TagKind,
+		PlainTextConfig: c,
+	}
+}
+
+// RegisterFuncs registers rendering functions to the given NodeRendererFuncRegisterer.
+func (r *inlineTagPlainTextRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(r.tagKind, r.renderInlineTag)
+}
+
+// renderInlineTag renders the content of an inline tag.
+func (r *inlineTagPlainTextRenderer) renderInlineTag(
+	w util.BufWriter, source []byte, n ast.Node, entering bool,
+) (ast.WalkStatus, error) {
+	if entering && r.Unicode {
+		if b, ok := toUnicodeScript(n, source, unicodeScripts(r.tagKind)); ok {
+			_, _ = w.Write(b)
+			return ast.WalkSkipChildren, nil
+		}
+	}
+	return ast.WalkContinue, nil
+}
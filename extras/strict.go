@@ -0,0 +1,45 @@
+package extras
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// escapedSpaceTransformer replaces the backslash-escaped spaces in tags of
+// the given kinds with no-break spaces, as Pandoc does.
+type escapedSpaceTransformer struct {
+	kinds []ast.NodeKind
+}
+
+var (
+	escapedSpace = []byte(`\ `)
+	noBreakSpace = []byte("\u00a0")
+)
+
+// Transform implements parser.ASTTransformer.
+func (t *escapedSpaceTransformer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	source := reader.Source()
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || !slices.Contains(t.kinds, n.Kind()) {
+			return ast.WalkContinue, nil
+		}
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			txt, ok := c.(*ast.Text)
+			if !ok {
+				continue
+			}
+			value := txt.Segment.Value(source)
+			if !bytes.Contains(value, escapedSpace) {
+				continue
+			}
+			s := ast.NewString(bytes.ReplaceAll(value, escapedSpace, noBreakSpace))
+			n.ReplaceChild(n, c, s)
+			c = s
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,70 @@
+package extras
+
+import (
+	"github.com/yuin/goldmark/ast"
+)
+
+// superscripts maps characters to their Unicode superscript form.
+var superscripts = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴',
+	'5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+	'+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾',
+	'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ',
+	'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ', 'k': 'ᵏ', 'l': 'ˡ', 'm': 'ᵐ', 'n': 'ⁿ',
+	'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ', 't': 'ᵗ', 'u': 'ᵘ', 'v': 'ᵛ',
+	'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ',
+	'A': 'ᴬ', 'B': 'ᴮ', 'D': 'ᴰ', 'E': 'ᴱ', 'G': 'ᴳ', 'H': 'ᴴ', 'I': 'ᴵ',
+	'J': 'ᴶ', 'K': 'ᴷ', 'L': 'ᴸ', 'M': 'ᴹ', 'N': 'ᴺ', 'O': 'ᴼ', 'P': 'ᴾ',
+	'R': 'ᴿ', 'T': 'ᵀ', 'U': 'ᵁ', 'V': 'ⱽ', 'W': 'ᵂ',
+}
+
+// subscripts maps characters to their Unicode subscript form.
+var subscripts = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄',
+	'5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+	'+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+	'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ',
+	'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ', 'p': 'ₚ', 'r': 'ᵣ', 's': 'ₛ', 't': 'ₜ',
+	'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+}
+
+// unicodeScripts returns the table of Unicode script characters for the
+// kind of tag, or nil if there is none.
+func unicodeScripts(kind ast.NodeKind) map[rune]rune {
+	switch kind {
+	case KindSuperscript:
+		return superscripts
+	case KindSubscript:
+		return subscripts
+	}
+	return nil
+}
+
+// toUnicodeScript returns the text of the children of n converted with
+// table. It reports false if a child is not text or a character has no
+// mapping.
+func toUnicodeScript(n ast.Node, source []byte, table map[rune]rune) ([]byte, bool) {
+	if table == nil || n.FirstChild() == nil {
+		return nil, false
+	}
+	var b []byte
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		var value []byte
+		switch c := c.(type) {
+		case *ast.Text:
+			value = c.Segment.Value(source)
+		case *ast.String:
+			value = c.Value
+		default:
+			return nil, false
+		}
+		for _, r := range string(value) {
+			s, ok := table[r]
+			if !ok {
+				return nil, false
+			}
+			b = append(b, string(s)...)
+		}
+	}
+	return b, true
+}
@@ -0,0 +1,91 @@
+package passthrough
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// dollarBacktickParser parses GitLab's inline math, written as $`a^2`$. As
+// with code spans, the closing backtick run must be as long as the opening
+// one, so that a longer run can enclose content with backticks.
+type dollarBacktickParser struct {
+	// template holds the name and output of the delimiters of the parsed
+	// nodes, whose Open and Close depend on the backtick run length.
+	template Delimiters
+}
+
+func newDollarBacktickParser(template Delimiters) parser.InlineParser {
+	return &dollarBacktickParser{template: template}
+}
+
+func (s *dollarBacktickParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (s *dollarBacktickParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, startSegment := block.PeekLine()
+	n := 0
+	for 1+n < len(line) && line[1+n] == '`' {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	ticks := strings.Repeat("`", n)
+	d := s.template
+	d.Open, d.Close = "$"+ticks, ticks+"$"
+
+	l, pos := block.Position()
+	block.Advance(len(d.Open))
+	var lines []text.Segment
+	for {
+		line, lineSegment := block.PeekLine()
+		lineStart := lineSegment
+		if lines == nil {
+			lineStart = startSegment
+		}
+		if line == nil {
+			// Unclosed: the opener is text, so that the $ isn't taken for a
+			// $ delimiter instead.
+			block.SetPosition(l, pos)
+			block.Advance(len(d.Open))
+			return ast.NewTextSegment(startSegment.WithStop(startSegment.Start + len(d.Open)))
+		}
+		closingDelimiterPos := closingBacktickIndex(line, n)
+		if closingDelimiterPos == -1 {
+			lines = append(lines, lineStart.WithStop(lineSegment.Stop))
+			block.AdvanceLine()
+			continue
+		}
+
+		seg := startSegment.WithStop(lineSegment.Start + closingDelimiterPos + len(d.Close))
+		block.Advance(closingDelimiterPos + len(d.Close))
+		node := newPassthroughInline(seg, &d)
+		if lines != nil {
+			node.LineSegments = append(lines, lineStart.WithStop(seg.Stop))
+		}
+		return node
+	}
+}
+
+// closingBacktickIndex returns the index in b of a run of exactly n backticks
+// followed by $, or -1 if there is none.
+func closingBacktickIndex(b []byte, n int) int {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '`' {
+			continue
+		}
+		j := i
+		for j < len(b) && b[j] == '`' {
+			j++
+		}
+		if j-i == n && j < len(b) && b[j] == '$' {
+			return i
+		}
+		i = j - 1
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+package passthrough
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/util"
+)
+
+// DiagnosticKind is the kind of problem reported by a Diagnostic.
+type DiagnosticKind int
+
+const (
+	// DiagnosticUnclosed is reported for an opening delimiter without a
+	// closing delimiter. The opening delimiter is rendered as text.
+	DiagnosticUnclosed DiagnosticKind = iota + 1
+
+	// DiagnosticEmpty is reported for a pair of delimiters with nothing
+	// between them. The delimiters are rendered as text.
+	DiagnosticEmpty
+
+	// DiagnosticCrossesBlocks is reported for an opening delimiter whose
+	// closing delimiter is in a later block, e.g. after a blank line or
+	// outside of the blockquote that contains the opening delimiter.
+	DiagnosticCrossesBlocks
+
+	// DiagnosticUnresolvedReference is reported for an equation reference,
+	// such as [@eq:energy], to an id that no passthrough block has.
+	DiagnosticUnresolvedReference
+)
+
+// String returns a description of the kind.
+func (k DiagnosticKind) String() string {
+	switch k {
+	case DiagnosticUnclosed:
+		return "unclosed passthrough"
+	case DiagnosticEmpty:
+		return "empty passthrough"
+	case DiagnosticCrossesBlocks:
+		return "passthrough crosses block boundary"
+	case DiagnosticUnresolvedReference:
+		return "unresolved equation reference"
+	default:
+		return "unknown passthrough diagnostic"
+	}
+}
+
+// Diagnostic describes an unclosed or suspicious passthrough.
+type Diagnostic struct {
+	Kind DiagnosticKind
+
+	// The delimiters involved. This is nil for unresolved references.
+	Delimiters *Delimiters
+
+	// The referenced id, for unresolved references.
+	ID string
+
+	// Offset is the byte offset of the opening delimiter or reference in the
+	// source.
+	Offset int
+
+	// Line and Column are the 1-based position of Offset. Column counts
+	// bytes.
+	Line   int
+	Column int
+}
+
+// String returns the diagnostic formatted as "line:column: message".
+func (d Diagnostic) String() string {
+	if d.Delimiters == nil {
+		return fmt.Sprintf("%d:%d: %s %q", d.Line, d.Column, d.Kind, d.ID)
+	}
+	return fmt.Sprintf("%d:%d: %s starting with %q", d.Line, d.Column, d.Kind, d.Delimiters.Open)
+}
+
+var diagnosticsKey = parser.NewContextKey()
+
+// GetDiagnostics returns the diagnostics recorded while parsing a document
+// with the given context, ordered by position. Pass the context to the
+// parser with parser.WithContext.
+func GetDiagnostics(pc parser.Context) []Diagnostic {
+	diags, _ := pc.Get(diagnosticsKey).([]Diagnostic)
+	diags = append([]Diagnostic(nil), diags...)
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Offset < diags[j].Offset
+	})
+	return diags
+}
+
+// addDiagnostic records a diagnostic for the opening delimiter d at offset
+// in source.
+func addDiagnostic(pc parser.Context, source []byte, kind DiagnosticKind, d *Delimiters, offset int) {
+	appendDiagnostic(pc, source, Diagnostic{
+		Kind:       kind,
+		Delimiters: d,
+		Offset:     offset,
+	})
+}
+
+// appendDiagnostic records diag after setting its line and column from its
+// offset in source.
+func appendDiagnostic(pc parser.Context, source []byte, diag Diagnostic) {
+	pos := getLineIndex(pc, source).position(diag.Offset)
+	diag.Line, diag.Column = pos.Line, pos.Column
+	diags, _ := pc.Get(diagnosticsKey).([]Diagnostic)
+	pc.Set(diagnosticsKey, append(diags, diag))
+}
+
+// unclosedKind returns the kind of diagnostic to report for the opening
+// delimiter d, whose block ended at offset stop without a closing delimiter.
+// The passthrough crosses a block boundary if the block that follows, which
+// it would have joined without the boundary, has a closing delimiter that is
+// not part of a passthrough of its own. delims are the delimiters of the
+// inline parser.
+func unclosedKind(delims []Delimiters, source []byte, d *Delimiters, stop, depth int) DiagnosticKind {
+	next := followingBlock(source, stop)
+	pos := 0
+	for _, span := range append(passthroughSpans(delims, next), [2]int{len(next), len(next)}) {
+		var i int
+		i, depth = d.closingDelimiterIndex(next[pos:span[0]], depth)
+		if i >= 0 {
+			return DiagnosticCrossesBlocks
+		}
+		pos = span[1]
+	}
+	return DiagnosticUnclosed
+}
+
+// followingBlock returns the lines of the block that follows the line
+// containing offset stop in source: the lines after any blank lines, up to
+// the next blank line.
+func followingBlock(source []byte, stop int) []byte {
+	if stop > 0 && source[stop-1] != '\n' {
+		if i := bytes.IndexByte(source[stop:], '\n'); i >= 0 {
+			stop += i + 1
+		} else {
+			stop = len(source)
+		}
+	}
+	start := -1
+	for pos := stop; pos < len(source); {
+		end := len(source)
+		if i := bytes.IndexByte(source[pos:], '\n'); i >= 0 {
+			end = pos + i + 1
+		}
+		blank := util.IsBlank(source[pos:end])
+		switch {
+		case start < 0 && !blank:
+			start = pos
+		case start >= 0 && blank:
+			return source[start:pos]
+		}
+		pos = end
+	}
+	if start < 0 {
+		return nil
+	}
+	return source[start:]
+}
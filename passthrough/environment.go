@@ -0,0 +1,259 @@
+package passthrough
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	environmentBegin = `\begin{`
+	environmentEnd   = `\end{`
+)
+
+// environmentDelimiters returns the delimiters of the LaTeX environment name,
+// with the name and output of template.
+func environmentDelimiters(name string, template Delimiters) *Delimiters {
+	return &Delimiters{
+		Open:   environmentBegin + name + "}",
+		Close:  environmentEnd + name + "}",
+		Name:   template.Name,
+		Output: template.Output,
+	}
+}
+
+// environmentTemplate returns the delimiters whose name and output apply to
+// environment blocks: template if it is set, and otherwise the first block
+// delimiters, without StripDelimiters as the \begin and \end are part of the
+// content.
+func environmentTemplate(template Delimiters, blockDelims []Delimiters) Delimiters {
+	if template != (Delimiters{}) || len(blockDelims) == 0 {
+		return template
+	}
+	d := blockDelims[0]
+	d.Output.StripDelimiters = false
+	return d
+}
+
+// parseEnvironmentName returns the environment name if b starts with
+// \begin{name}, or an empty string otherwise.
+func parseEnvironmentName(b []byte) string {
+	if !startsWith(b, environmentBegin) {
+		return ""
+	}
+	b = b[len(environmentBegin):]
+	i := bytes.IndexByte(b, '}')
+	if i <= 0 {
+		return ""
+	}
+	return string(b[:i])
+}
+
+// scanEnvironment scans b for the \begin and \end of environment d, starting
+// at the given nesting depth. It returns the position just after the \end
+// that brings the depth to zero, or -1 if there is none, and the depth at
+// the end of the scan. Backslash-escaped markers are skipped.
+func scanEnvironment(b []byte, d *Delimiters, depth int) (int, int) {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' {
+			continue
+		}
+		switch {
+		case i+1 < len(b) && b[i+1] == '\\':
+			i++
+		case startsWith(b[i:], d.Open):
+			depth++
+			i += len(d.Open) - 1
+		case startsWith(b[i:], d.Close):
+			depth--
+			i += len(d.Close) - 1
+			if depth == 0 {
+				return i + 1, depth
+			}
+		}
+	}
+	return -1, depth
+}
+
+// unclosedEnvironmentKind is like unclosedKind for the environment d, whose
+// block ended at offset stop with the given depth before its \end.
+func unclosedEnvironmentKind(source []byte, d *Delimiters, stop, depth int) DiagnosticKind {
+	if end, _ := scanEnvironment(followingBlock(source, stop), d, depth); end >= 0 {
+		return DiagnosticCrossesBlocks
+	}
+	return DiagnosticUnclosed
+}
+
+// environmentBalance is like Delimiters.closerBalance for scanEnvironment,
+// which finds the \end that brings the depth to zero.
+func environmentBalance(b []byte, d *Delimiters) (threshold, net int, ok bool) {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '\\' {
+			continue
+		}
+		switch {
+		case i+1 < len(b) && b[i+1] == '\\':
+			i++
+		case startsWith(b[i:], d.Open):
+			net++
+			i += len(d.Open) - 1
+		case startsWith(b[i:], d.Close):
+			// The scan returns if the depth is one here.
+			if !ok || 1-net > threshold {
+				threshold, ok = 1-net, true
+			}
+			net--
+			i += len(d.Close) - 1
+		}
+	}
+	return threshold, net, ok
+}
+
+// environmentPassthroughParser parses LaTeX environments, such as
+// \begin{align} ... \end{align}, that start a line as passthrough blocks.
+// Environments with the same name may be nested.
+type environmentPassthroughParser struct {
+	Environments []string
+
+	// All delimiters handled by the inline parser, used to decide whether a
+	// paragraph can be interrupted.
+	InlineDelimiters []Delimiters
+
+	// The name and output of the environment delimiters.
+	Template Delimiters
+
+	// Whether an attribute list may follow the \end.
+	Attributes bool
+}
+
+func newEnvironmentPassthroughParser(envs []string, inlineDelims []Delimiters, template Delimiters, attributes bool) parser.BlockParser {
+	return &environmentPassthroughParser{
+		Environments:     envs,
+		InlineDelimiters: inlineDelims,
+		Template:         template,
+		Attributes:       attributes,
+	}
+}
+
+var environmentPassthroughInfoKey = parser.NewContextKey()
+
+// Trigger implements parser.BlockParser.
+func (b *environmentPassthroughParser) Trigger() []byte {
+	return []byte{'\\'}
+}
+
+// Open implements parser.BlockParser.
+func (b *environmentPassthroughParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+
+	name := parseEnvironmentName(line[pos:])
+	if name == "" || !slices.Contains(b.Environments, name) {
+		return nil, parser.NoChildren
+	}
+
+	if paragraphHasUnclosedPassthrough(b.InlineDelimiters, reader.Source(), pc) {
+		return nil, parser.NoChildren
+	}
+
+	fencePair := environmentDelimiters(name, b.Template)
+	start := segment.Start - segment.Padding + pos
+	end, depth := scanEnvironment(line[pos:], fencePair, 0)
+
+	node := newPassthroughBlock(fencePair)
+	node.Environment = name
+	data := &passthroughBlockData{node: node, depth: depth}
+	if end >= 0 {
+		// Text after the \end on the same line, other than an attribute
+		// list, is not supported.
+		if after := line[pos+end:]; !util.IsBlank(after) {
+			attrs, ok := parseTrailingAttributes(after)
+			if !ok || !b.Attributes {
+				return nil, parser.NoChildren
+			}
+			setAttributes(node, attrs, pc)
+		}
+		node.Lines().Append(text.NewSegment(start, start+end))
+		data.closed = true
+	} else {
+		// Without a matching \end later in its container, the environment
+		// is plain text.
+		found, stop := findContainerCloser(pc, reader.Source(), segment.Stop, parent, fencePair, depth, func(line []byte) (int, int, bool) {
+			return environmentBalance(line, fencePair)
+		})
+		if !found {
+			kind := unclosedEnvironmentKind(reader.Source(), fencePair, stop, depth)
+			addDiagnostic(pc, reader.Source(), kind, fencePair, start)
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, segment.Stop))
+	}
+
+	reader.AdvanceToEOL()
+	pc.Set(environmentPassthroughInfoKey, data)
+	return node, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser.
+func (b *environmentPassthroughParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	data := pc.Get(environmentPassthroughInfoKey).(*passthroughBlockData)
+	if data.closed {
+		return parser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+
+	end, depth := scanEnvironment(line, node.(*PassthroughBlock).Delimiters, data.depth)
+	data.depth = depth
+	if end < 0 {
+		node.Lines().Append(segment)
+		reader.AdvanceToEOL()
+		return parser.Continue | parser.NoChildren
+	}
+
+	// Anything after the \end, other than an attribute list, is parsed as a
+	// new block.
+	node.Lines().Append(segment.WithStop(segment.Start - segment.Padding + end))
+	if attrs, ok := parseTrailingAttributes(line[end:]); ok && b.Attributes {
+		setAttributes(node, attrs, pc)
+		reader.AdvanceToEOL()
+	} else {
+		reader.Advance(end)
+	}
+	data.closed = true
+	return parser.Close
+}
+
+// Close implements parser.BlockParser.
+func (b *environmentPassthroughParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	data, ok := pc.Get(environmentPassthroughInfoKey).(*passthroughBlockData)
+	if ok && data.node == node {
+		if !data.closed {
+			lines := node.Lines()
+			d := node.(*PassthroughBlock).Delimiters
+			kind := unclosedEnvironmentKind(reader.Source(), d, lines.At(lines.Len()-1).Stop, data.depth)
+			addDiagnostic(pc, reader.Source(), kind, d, lines.At(0).Start)
+		}
+		pc.Set(environmentPassthroughInfoKey, nil)
+	}
+}
+
+// CanInterruptParagraph implements parser.BlockParser.
+func (b *environmentPassthroughParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser.
+func (b *environmentPassthroughParser) CanAcceptIndentedLine() bool {
+	return false
+}
@@ -0,0 +1,114 @@
+package passthrough
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// defaultFenceDelimiters are the delimiters of the blocks parsed from fenced
+// code blocks when there are no block delimiters.
+var defaultFenceDelimiters = Delimiters{Open: "$$", Close: "$$"}
+
+// fencedCodeBlockParser parses the fenced code blocks with one of the given
+// languages, e.g. ```math, as passthrough blocks. It leaves the scanning of
+// the fences to goldmark's fenced code block parser, and must run before it.
+type fencedCodeBlockParser struct {
+	fenced     parser.BlockParser
+	languages  []string
+	delimiters *Delimiters
+	attributes bool
+}
+
+func newFencedCodeBlockParser(languages []string, blockDelims []Delimiters, attributes bool) parser.BlockParser {
+	d := defaultFenceDelimiters
+	if len(blockDelims) > 0 {
+		d = blockDelims[0]
+	}
+	return &fencedCodeBlockParser{
+		fenced:     parser.NewFencedCodeBlockParser(),
+		languages:  languages,
+		delimiters: &d,
+		attributes: attributes,
+	}
+}
+
+type fencedCodeBlockData struct {
+	node  *PassthroughBlock
+	fence *ast.FencedCodeBlock
+
+	// The offset just after the last fence or content line seen so far.
+	stop int
+}
+
+var fencedCodeBlockInfoKey = parser.NewContextKey()
+
+// Trigger implements parser.BlockParser.
+func (b *fencedCodeBlockParser) Trigger() []byte {
+	return b.fenced.Trigger()
+}
+
+// Open implements parser.BlockParser.
+func (b *fencedCodeBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	n, state := b.fenced.Open(parent, reader, pc)
+	fence, ok := n.(*ast.FencedCodeBlock)
+	if !ok || fence.Info == nil {
+		return nil, parser.NoChildren
+	}
+	source := reader.Source()
+	language := fence.Language(source)
+	if !slices.Contains(b.languages, string(language)) {
+		return nil, parser.NoChildren
+	}
+
+	info := fence.Info.Segment.Value(source)
+	node := newPassthroughBlock(b.delimiters)
+	node.Fence = string(info)
+	// An attribute list may follow the language, e.g. ```math {#eq:a}.
+	// Setting it now registers its id before later headings get theirs.
+	if rest := info[len(language):]; b.attributes && !util.IsBlank(rest) {
+		if attrs, ok := parseTrailingAttributes(bytes.TrimLeft(rest, " \t")); ok {
+			setAttributes(node, attrs, pc)
+		}
+	}
+	stop := segment.Stop - util.TrimRightSpaceLength(line)
+	pc.Set(fencedCodeBlockInfoKey, &fencedCodeBlockData{node: node, fence: fence, stop: stop})
+	return node, state
+}
+
+// Continue implements parser.BlockParser.
+func (b *fencedCodeBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	data := pc.Get(fencedCodeBlockInfoKey).(*fencedCodeBlockData)
+	line, segment := reader.PeekLine()
+	state := b.fenced.Continue(data.fence, reader, pc)
+	data.stop = segment.Stop - util.TrimRightSpaceLength(line)
+	return state
+}
+
+// Close implements parser.BlockParser.
+func (b *fencedCodeBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	data, ok := pc.Get(fencedCodeBlockInfoKey).(*fencedCodeBlockData)
+	if !ok || data.node != node {
+		return
+	}
+	b.fenced.Close(data.fence, reader, pc)
+	lines := data.fence.Lines()
+	data.node.Lines().AppendAll(lines.Sliced(0, lines.Len()))
+	data.node.fenceSegment = text.NewSegment(node.Pos(), data.stop)
+	pc.Set(fencedCodeBlockInfoKey, nil)
+}
+
+// CanInterruptParagraph implements parser.BlockParser.
+func (b *fencedCodeBlockParser) CanInterruptParagraph() bool {
+	return b.fenced.CanInterruptParagraph()
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser.
+func (b *fencedCodeBlockParser) CanAcceptIndentedLine() bool {
+	return b.fenced.CanAcceptIndentedLine()
+}
@@ -0,0 +1,112 @@
+package passthrough
+
+import (
+	"sort"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Inventory lists the passthroughs in a document, e.g. to decide whether a
+// page needs a math library.
+type Inventory struct {
+	// The number of PassthroughInline and PassthroughBlock nodes.
+	Inline int
+	Block  int
+
+	// The passthroughs in document order.
+	Entries []InventoryEntry
+}
+
+// InventoryEntry describes a passthrough node.
+type InventoryEntry struct {
+	// The node, a *PassthroughInline or a *PassthroughBlock.
+	Node ast.Node
+
+	// The delimiters that matched.
+	Delimiters *Delimiters
+
+	// Start and Stop are the byte offsets of the passthrough, including its
+	// delimiters, or the fences of a fenced code block, in the source.
+	Start int
+	Stop  int
+
+	// The content without delimiters.
+	Content []byte
+}
+
+// Len returns the number of passthroughs.
+func (inv Inventory) Len() int {
+	return len(inv.Entries)
+}
+
+// Names returns the sorted, unique names of the delimiters used.
+func (inv Inventory) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, e := range inv.Entries {
+		if name := e.Delimiters.Name; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewInventory returns the inventory of the passthroughs in doc, parsed from
+// source.
+func NewInventory(doc ast.Node, source []byte) Inventory {
+	var inv Inventory
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		start, stop, ok := span(n)
+		switch n := n.(type) {
+		case *PassthroughInline:
+			inv.Inline++
+			inv.Entries = append(inv.Entries, InventoryEntry{
+				Node:       n,
+				Delimiters: n.Delimiters,
+				Start:      start,
+				Stop:       stop,
+				Content:    trimDelimiters(n.Value(source), n.Delimiters),
+			})
+		case *PassthroughBlock:
+			inv.Block++
+			e := InventoryEntry{
+				Node:       n,
+				Delimiters: n.Delimiters,
+			}
+			if ok {
+				e.Start, e.Stop = start, stop
+				e.Content = trimDelimiters(n.Value(source), n.Delimiters)
+			}
+			inv.Entries = append(inv.Entries, e)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return inv
+}
+
+var inventoryKey = parser.NewContextKey()
+
+// GetInventory returns the inventory of the passthroughs in the document
+// parsed with the given context. Pass the context to the parser with
+// parser.WithContext.
+func GetInventory(pc parser.Context) Inventory {
+	inv, _ := pc.Get(inventoryKey).(Inventory)
+	return inv
+}
+
+// inventoryTransformer stores the inventory in the parser context. It runs
+// after the transformers that create and number passthrough blocks.
+type inventoryTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *inventoryTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	pc.Set(inventoryKey, NewInventory(doc, reader.Source()))
+}
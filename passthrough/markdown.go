@@ -0,0 +1,186 @@
+package passthrough
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// NewMarkdownRenderer returns a renderer.NodeRenderer that renders the nodes
+// of this package back to Markdown, for use with a renderer that formats
+// documents as Markdown. Passthroughs are written as they appear in the
+// source, with their original delimiters. Blocks that were split out of a
+// paragraph are written as blocks of their own.
+func NewMarkdownRenderer() renderer.NodeRenderer {
+	return &markdownRenderer{}
+}
+
+type markdownRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *markdownRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindPassthroughInline, r.renderInline)
+	reg.Register(KindPassthroughBlock, r.renderBlock)
+	reg.Register(KindEquationReference, r.renderEquationReference)
+}
+
+func (r *markdownRenderer) renderInline(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		inline := n.(*PassthroughInline)
+		if inline.LineSegments == nil {
+			_, _ = w.Write(inline.Value(source))
+		} else {
+			writeLines(w, source, inline.LineSegments, containerPrefix(n), false)
+		}
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *markdownRenderer) renderBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	block := n.(*PassthroughBlock)
+	lines := block.Lines().Sliced(0, block.Lines().Len())
+	prefix := containerPrefix(n)
+	if block.Fence != "" {
+		// The info string holds the attributes, if any.
+		fence := codeFence(block.Lines().Value(source))
+		_, _ = w.WriteString(fence + block.Fence + "\n")
+		writeLines(w, source, lines, prefix, true)
+		_, _ = w.Write(prefix)
+		_, _ = w.WriteString(fence + "\n")
+		return ast.WalkSkipChildren, nil
+	}
+	if len(lines) > 0 {
+		if last := &lines[len(lines)-1]; bytes.HasSuffix(last.Value(source), []byte("\n")) {
+			*last = last.WithStop(last.Stop - 1)
+		}
+	}
+	writeLines(w, source, lines, prefix, false)
+	if n.Attributes() != nil {
+		_ = w.WriteByte(' ')
+		writeMarkdownAttributes(w, n)
+	}
+	_ = w.WriteByte('\n')
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *markdownRenderer) renderEquationReference(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.Write(n.(*EquationReference).Segment.Value(source))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// containerPrefix returns the prefix that the block quotes and list items
+// around n start each of its lines but the first with.
+func containerPrefix(n ast.Node) []byte {
+	var prefix []byte
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		switch p := p.(type) {
+		case *ast.Blockquote:
+			prefix = append([]byte("> "), prefix...)
+		case *ast.ListItem:
+			prefix = append(bytes.Repeat([]byte(" "), p.Offset), prefix...)
+		}
+	}
+	return prefix
+}
+
+// writeLines writes segs, the lines of a passthrough, each starting with
+// prefix, except the first unless all is set.
+func writeLines(w util.BufWriter, source []byte, segs []text.Segment, prefix []byte, all bool) {
+	for i, seg := range segs {
+		if i > 0 || all {
+			_, _ = w.Write(prefix)
+		}
+		_, _ = w.Write(seg.Value(source))
+	}
+}
+
+// codeFence returns a backtick fence longer than any that starts a line of
+// content.
+func codeFence(content []byte) string {
+	n := 3
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimLeft(line, " ")
+		i := 0
+		for i < len(line) && line[i] == '`' {
+			i++
+		}
+		if i >= n {
+			n = i + 1
+		}
+	}
+	return strings.Repeat("`", n)
+}
+
+// writeMarkdownAttributes writes the attributes of n as an attribute list,
+// e.g. {#id .class key="value"}, as written after a block.
+func writeMarkdownAttributes(w util.BufWriter, n ast.Node) {
+	_ = w.WriteByte('{')
+	for i, attr := range n.Attributes() {
+		if i > 0 {
+			_ = w.WriteByte(' ')
+		}
+		value, ok := attr.Value.([]byte)
+		if !ok {
+			_, _ = w.Write(attr.Name)
+			_ = w.WriteByte('=')
+			writeMarkdownAttributeValue(w, attr.Value)
+			continue
+		}
+		switch string(attr.Name) {
+		case "id":
+			_ = w.WriteByte('#')
+			_, _ = w.Write(value)
+		case "class":
+			for j, class := range bytes.Fields(value) {
+				if j > 0 {
+					_ = w.WriteByte(' ')
+				}
+				_ = w.WriteByte('.')
+				_, _ = w.Write(class)
+			}
+		default:
+			_, _ = w.Write(attr.Name)
+			_ = w.WriteByte('=')
+			writeMarkdownAttributeValue(w, value)
+		}
+	}
+	_ = w.WriteByte('}')
+}
+
+// writeMarkdownAttributeValue writes an attribute value as parsed by
+// parser.ParseAttributes: strings are quoted, numbers, booleans and null are
+// written as is, and arrays are written as [a, b].
+func writeMarkdownAttributeValue(w util.BufWriter, v any) {
+	switch v := v.(type) {
+	case []byte:
+		_, _ = w.WriteString(strconv.Quote(string(v)))
+	case []any:
+		_ = w.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				_, _ = w.WriteString(", ")
+			}
+			writeMarkdownAttributeValue(w, e)
+		}
+		_ = w.WriteByte(']')
+	case float64:
+		_, _ = w.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		_, _ = w.WriteString(strconv.FormatBool(v))
+	case nil:
+		_, _ = w.WriteString("null")
+	default:
+		_, _ = w.WriteString(strconv.Quote(fmt.Sprint(v)))
+	}
+}
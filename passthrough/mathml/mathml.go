@@ -0,0 +1,864 @@
+// Package mathml provides a passthrough.Renderer that converts LaTeX math to
+// MathML Core, so that math can be rendered without JavaScript.
+//
+// A practical subset of LaTeX is supported: sub- and superscripts, fractions,
+// roots, Greek letters and common symbols, operators with limits, accents,
+// \left and \right, font commands, \text, spacing, and the matrix, cases and
+// alignment environments. Content with unsupported commands is rendered as
+// is.
+package mathml
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gohugoio/hugo-goldmark-extensions/passthrough"
+	"github.com/yuin/goldmark/util"
+)
+
+// Config configures the renderer.
+type Config struct {
+	// Names restricts conversion to passthroughs whose delimiters have one of
+	// these names. If empty, all passthroughs are converted.
+	Names []string
+
+	// Annotate adds the LaTeX source to the output as an annotation, which
+	// some browsers and screen readers use for copying and speech.
+	Annotate bool
+}
+
+// New returns a passthrough.Renderer that converts LaTeX math to MathML.
+// Passthroughs with block delimiters are rendered with display="block".
+func New(c Config) passthrough.Renderer {
+	return &mathMLRenderer{conf: c}
+}
+
+type mathMLRenderer struct {
+	conf Config
+}
+
+// RenderInline implements passthrough.Renderer.
+func (r *mathMLRenderer) RenderInline(w util.BufWriter, ctx passthrough.RenderContext) error {
+	return r.render(w, ctx.Content, ctx)
+}
+
+// RenderBlock implements passthrough.Renderer.
+func (r *mathMLRenderer) RenderBlock(w util.BufWriter, ctx passthrough.RenderContext) error {
+	tex := ctx.Content
+	if n, ok := ctx.Node.(*passthrough.PassthroughBlock); ok && n.Environment != "" {
+		// The content of an environment passthrough must keep its \begin and
+		// \end to be understood.
+		tex = []byte(ctx.Delimiters.Open + string(tex) + ctx.Delimiters.Close)
+	}
+	if err := r.render(w, tex, ctx); err != nil {
+		return err
+	}
+	_, _ = w.WriteString("\n")
+	return nil
+}
+
+func (r *mathMLRenderer) render(w util.BufWriter, tex []byte, ctx passthrough.RenderContext) error {
+	if len(r.conf.Names) > 0 && !slices.Contains(r.conf.Names, ctx.Delimiters.Name) {
+		return passthrough.ErrUseDefault
+	}
+	s, err := convert(tex, ctx.Display, r.conf.Annotate)
+	if err != nil {
+		return passthrough.ErrUseDefault
+	}
+	_, _ = w.WriteString(s)
+	return nil
+}
+
+// ErrUnsupported is returned by Convert for LaTeX that can't be converted.
+var ErrUnsupported = errors.New("unsupported LaTeX")
+
+// Convert converts LaTeX math to a MathML math element. If display is set,
+// the element has display="block". Errors wrap ErrUnsupported.
+func Convert(tex []byte, display bool) (string, error) {
+	return convert(tex, display, false)
+}
+
+func convert(tex []byte, display, annotate bool) (string, error) {
+	p := &mathParser{src: tex, toks: tokenize(tex)}
+	nodes, err := p.parseExprUntil("")
+	if err != nil {
+		return "", err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return "", p.unexpected(t)
+	}
+
+	var b strings.Builder
+	b.WriteString("<math")
+	if display {
+		b.WriteString(` display="block"`)
+	}
+	b.WriteString(">")
+	if annotate {
+		b.WriteString("<semantics>")
+		b.WriteString(row(nodes))
+		b.WriteString(`<annotation encoding="application/x-tex">`)
+		b.WriteString(html.EscapeString(strings.TrimSpace(string(tex))))
+		b.WriteString("</annotation></semantics>")
+	} else {
+		b.WriteString(row(nodes))
+	}
+	b.WriteString("</math>")
+	return b.String(), nil
+}
+
+// ---- Tokenizer ----
+
+type tokenKind int
+
+const (
+	tokEOF     tokenKind = iota
+	tokChar              // a single character
+	tokNumber            // a run of digits, possibly with a decimal point
+	tokCommand           // a command, with the name in value
+	tokOpen              // {
+	tokClose             // }
+	tokSup               // ^
+	tokSub               // _
+	tokAmp               // &
+	tokNewline           // \\
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+
+	// The byte offsets of the token in the source.
+	start, end int
+}
+
+func tokenize(src []byte) []token {
+	var toks []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRune(src[i:])
+		start := i
+		i += size
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case r == '%':
+			// A comment runs to the end of the line.
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case r == '\\':
+			if i >= len(src) {
+				toks = append(toks, token{tokChar, `\`, start, i})
+				continue
+			}
+			if src[i] == '\\' {
+				i++
+				toks = append(toks, token{tokNewline, `\\`, start, i})
+				continue
+			}
+			j := i
+			for j < len(src) && isASCIILetter(src[j]) {
+				j++
+			}
+			if j == i {
+				_, size := utf8.DecodeRune(src[i:])
+				j = i + size
+			}
+			toks = append(toks, token{tokCommand, string(src[i:j]), start, j})
+			i = j
+		case r == '{':
+			toks = append(toks, token{tokOpen, "{", start, i})
+		case r == '}':
+			toks = append(toks, token{tokClose, "}", start, i})
+		case r == '^':
+			toks = append(toks, token{tokSup, "^", start, i})
+		case r == '_':
+			toks = append(toks, token{tokSub, "_", start, i})
+		case r == '&':
+			toks = append(toks, token{tokAmp, "&", start, i})
+		case r >= '0' && r <= '9':
+			for i < len(src) && (isDigit(src[i]) || (src[i] == '.' && i+1 < len(src) && isDigit(src[i+1]))) {
+				i++
+			}
+			toks = append(toks, token{tokNumber, string(src[start:i]), start, i})
+		default:
+			toks = append(toks, token{tokChar, string(r), start, i})
+		}
+	}
+	return append(toks, token{kind: tokEOF, start: len(src), end: len(src)})
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ---- Parser ----
+
+// maxDepth limits the nesting of groups and command arguments to keep
+// pathological input from exhausting the stack.
+const maxDepth = 200
+
+type mathParser struct {
+	src   []byte
+	toks  []token
+	pos   int
+	depth int
+}
+
+func (p *mathParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *mathParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *mathParser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("%w: unexpected end of input", ErrUnsupported)
+	}
+	if t.kind == tokCommand {
+		return fmt.Errorf("%w: unexpected \\%s", ErrUnsupported, t.value)
+	}
+	return fmt.Errorf("%w: unexpected %q", ErrUnsupported, t.value)
+}
+
+// enter increases the nesting depth, and returns an error if it exceeds
+// maxDepth. It must be paired with a call to leave.
+func (p *mathParser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return fmt.Errorf("%w: nested too deeply", ErrUnsupported)
+	}
+	return nil
+}
+
+// leave decreases the nesting depth.
+func (p *mathParser) leave() {
+	p.depth--
+}
+
+// isStop reports whether t ends the current expression: the end of a group,
+// cell or row, an environment, a \right, or the stop character.
+func isStop(t token, stop string) bool {
+	switch t.kind {
+	case tokEOF, tokClose, tokAmp, tokNewline:
+		return true
+	case tokCommand:
+		return t.value == "end" || t.value == "right" || t.value == "middle"
+	case tokChar:
+		return stop != "" && t.value == stop
+	}
+	return false
+}
+
+// parseExprUntil parses a sequence of atoms with their scripts, up to a token
+// for which isStop reports true, which is not consumed.
+func (p *mathParser) parseExprUntil(stop string) ([]string, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	var nodes []string
+	for !isStop(p.peek(), stop) {
+		t := p.peek()
+		if t.kind == tokCommand {
+			switch t.value {
+			case "displaystyle", "textstyle":
+				p.next()
+				rest, err := p.parseExprUntil(stop)
+				if err != nil {
+					return nil, err
+				}
+				nodes = append(nodes, fmt.Sprintf(`<mstyle displaystyle="%t">%s</mstyle>`, t.value == "displaystyle", row(rest)))
+				return nodes, nil
+			case "label", "tag":
+				// Labels and tags are for numbering, which MathML can't do.
+				p.next()
+				if _, err := p.rawGroup(); err != nil {
+					return nil, err
+				}
+				continue
+			case "nonumber", "notag":
+				p.next()
+				continue
+			}
+		}
+		n, err := p.parseScripted()
+		if err != nil {
+			return nil, err
+		}
+		if n != "" {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+// parseScripted parses an atom followed by any sub- and superscripts.
+func (p *mathParser) parseScripted() (string, error) {
+	base, limits, err := p.parseAtom()
+	if err != nil {
+		return "", err
+	}
+
+	var sub, sup string
+	primes := ""
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokCommand && t.value == "limits":
+			p.next()
+			limits = true
+			continue
+		case t.kind == tokCommand && t.value == "nolimits":
+			p.next()
+			limits = false
+			continue
+		case t.kind == tokChar && t.value == "'":
+			p.next()
+			primes += "′"
+			continue
+		case t.kind == tokSub && sub == "":
+			p.next()
+			sub, err = p.parseArg()
+		case t.kind == tokSup && sup == "":
+			p.next()
+			sup, err = p.parseArg()
+		case t.kind == tokSub || t.kind == tokSup:
+			return "", fmt.Errorf("%w: double script", ErrUnsupported)
+		default:
+			if primes != "" {
+				if sup != "" {
+					sup = row([]string{mo(primes), sup})
+				} else {
+					sup = mo(primes)
+				}
+			}
+			return attachScripts(base, sub, sup, limits), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func attachScripts(base, sub, sup string, limits bool) string {
+	if base == "" {
+		base = "<mrow></mrow>"
+	}
+	under, over := "msub", "msup"
+	both := "msubsup"
+	if limits {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return fmt.Sprintf("<%s>%s%s%s</%s>", both, base, sub, sup, both)
+	case sub != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", under, base, sub, under)
+	case sup != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", over, base, sup, over)
+	}
+	return base
+}
+
+// parseArg parses the argument of a command or script: a group or a single
+// atom.
+func (p *mathParser) parseArg() (string, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokOpen:
+		return p.parseGroup()
+	case tokNumber:
+		// Only the first digit is the argument, as in x^23.
+		p.next()
+		if len(t.value) > 1 {
+			p.toks = slices.Insert(p.toks, p.pos, token{tokNumber, t.value[1:], t.start + 1, t.end})
+		}
+		return mn(t.value[:1]), nil
+	case tokChar, tokCommand:
+		n, _, err := p.parseAtom()
+		return n, err
+	}
+	return "", p.unexpected(t)
+}
+
+// parseGroup parses {...} into a single node.
+func (p *mathParser) parseGroup() (string, error) {
+	if t := p.next(); t.kind != tokOpen {
+		return "", p.unexpected(t)
+	}
+	nodes, err := p.parseExprUntil("")
+	if err != nil {
+		return "", err
+	}
+	if t := p.next(); t.kind != tokClose {
+		return "", p.unexpected(t)
+	}
+	return row(nodes), nil
+}
+
+// rawGroup returns the source between the braces of the next group.
+func (p *mathParser) rawGroup() (string, error) {
+	open := p.next()
+	if open.kind != tokOpen {
+		return "", p.unexpected(open)
+	}
+	depth := 1
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokEOF:
+			return "", p.unexpected(t)
+		case tokOpen:
+			depth++
+		case tokClose:
+			depth--
+			if depth == 0 {
+				return string(p.src[open.end:t.start]), nil
+			}
+		}
+	}
+}
+
+// parseAtom parses a single element. It also reports whether scripts on the
+// element are placed as limits. The arguments of commands such as \hat and
+// \sqrt are parsed recursively, so atoms count towards the nesting depth.
+func (p *mathParser) parseAtom() (string, bool, error) {
+	if err := p.enter(); err != nil {
+		return "", false, err
+	}
+	defer p.leave()
+
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return mn(t.value), false, nil
+	case tokOpen:
+		p.pos--
+		n, err := p.parseGroup()
+		return n, false, err
+	case tokChar:
+		return charNode(t.value), false, nil
+	case tokSup, tokSub:
+		// A script with no base, as in {}^{14}C or ^2.
+		p.pos--
+		return "", false, nil
+	case tokCommand:
+		return p.parseCommand(t)
+	}
+	return "", false, p.unexpected(t)
+}
+
+func charNode(c string) string {
+	r, _ := utf8.DecodeRuneInString(c)
+	switch {
+	case c == "-":
+		return mo("−")
+	case c == "~":
+		return `<mspace width="0.3333em"></mspace>`
+	case c == "(" || c == ")" || c == "[" || c == "]" || c == "|":
+		return `<mo stretchy="false">` + html.EscapeString(c) + "</mo>"
+	case unicode.IsLetter(r):
+		return mi(c)
+	case unicode.IsDigit(r):
+		return mn(c)
+	}
+	return mo(c)
+}
+
+func (p *mathParser) parseCommand(t token) (string, bool, error) {
+	name := t.value
+	if s, ok := symbols[name]; ok {
+		return s.node(), s.limits, nil
+	}
+	if s, ok := functions[name]; ok {
+		if s {
+			return `<mo form="prefix" movablelimits="true">` + name + "</mo>", true, nil
+		}
+		return mi(name), false, nil
+	}
+	if s, ok := spaces[name]; ok {
+		return fmt.Sprintf(`<mspace width="%s"></mspace>`, s), false, nil
+	}
+	if a, ok := accents[name]; ok {
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", false, err
+		}
+		if a.under {
+			return fmt.Sprintf(`<munder accentunder="true">%s<mo>%s</mo></munder>`, arg, a.char), false, nil
+		}
+		return fmt.Sprintf(`<mover accent="true">%s<mo>%s</mo></mover>`, arg, a.char), false, nil
+	}
+	if v, ok := fonts[name]; ok {
+		raw, err := p.rawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		n, err := styled(raw, v)
+		return n, false, err
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.parseArg()
+		if err != nil {
+			return "", false, err
+		}
+		den, err := p.parseArg()
+		if err != nil {
+			return "", false, err
+		}
+		frac := "<mfrac>" + num + den + "</mfrac>"
+		switch name {
+		case "dfrac", "cfrac":
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		case "tfrac":
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return frac, false, nil
+	case "binom":
+		top, err := p.parseArg()
+		if err != nil {
+			return "", false, err
+		}
+		bottom, err := p.parseArg()
+		if err != nil {
+			return "", false, err
+		}
+		return `<mrow><mo>(</mo><mfrac linethickness="0">` + top + bottom + `</mfrac><mo>)</mo></mrow>`, false, nil
+	case "sqrt":
+		var index string
+		if t := p.peek(); t.kind == tokChar && t.value == "[" {
+			p.next()
+			nodes, err := p.parseExprUntil("]")
+			if err != nil {
+				return "", false, err
+			}
+			if t := p.next(); t.kind != tokChar || t.value != "]" {
+				return "", false, p.unexpected(t)
+			}
+			index = row(nodes)
+		}
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", false, err
+		}
+		if index != "" {
+			return "<mroot>" + arg + index + "</mroot>", false, nil
+		}
+		return "<msqrt>" + arg + "</msqrt>", false, nil
+	case "text", "textrm", "textit", "textbf", "mbox":
+		raw, err := p.rawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		return "<mtext>" + html.EscapeString(text(textEscapes.Replace(raw))) + "</mtext>", false, nil
+	case "operatorname":
+		raw, err := p.rawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		return mi(strings.TrimSpace(raw)), false, nil
+	case "left":
+		return p.parseLeftRight()
+	case "big", "Big", "bigg", "Bigg", "bigl", "Bigl", "biggl", "Biggl", "bigr", "Bigr", "biggr", "Biggr", "bigm", "Bigm":
+		d, err := p.parseDelimiter()
+		if err != nil {
+			return "", false, err
+		}
+		return `<mo stretchy="false">` + d + "</mo>", false, nil
+	case "not":
+		n, _, err := p.parseAtom()
+		if err != nil {
+			return "", false, err
+		}
+		// Negate the operator by adding a combining long solidus.
+		if strings.HasPrefix(n, "<mo") && strings.HasSuffix(n, "</mo>") {
+			return strings.TrimSuffix(n, "</mo>") + "̸</mo>", false, nil
+		}
+		return "", false, fmt.Errorf("%w: \\not", ErrUnsupported)
+	case "begin":
+		return p.parseEnvironment()
+	}
+	return "", false, fmt.Errorf("%w: \\%s", ErrUnsupported, name)
+}
+
+// parseDelimiter parses the delimiter after \left, \right or \big.
+func (p *mathParser) parseDelimiter() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokChar:
+		if t.value == "." {
+			return "", nil
+		}
+		if strings.Contains("()[]|/<>", t.value) {
+			if t.value == "<" {
+				return "⟨", nil
+			}
+			if t.value == ">" {
+				return "⟩", nil
+			}
+			return html.EscapeString(t.value), nil
+		}
+	case tokCommand:
+		if d, ok := delimiters[t.value]; ok {
+			return d, nil
+		}
+	}
+	return "", p.unexpected(t)
+}
+
+func (p *mathParser) parseLeftRight() (string, bool, error) {
+	open, err := p.parseDelimiter()
+	if err != nil {
+		return "", false, err
+	}
+	nodes := []string{fence(open)}
+	for {
+		inner, err := p.parseExprUntil("")
+		if err != nil {
+			return "", false, err
+		}
+		nodes = append(nodes, inner...)
+		t := p.next()
+		if t.kind != tokCommand || (t.value != "middle" && t.value != "right") {
+			return "", false, p.unexpected(t)
+		}
+		d, err := p.parseDelimiter()
+		if err != nil {
+			return "", false, err
+		}
+		nodes = append(nodes, fence(d))
+		if t.value == "right" {
+			return "<mrow>" + strings.Join(nodes, "") + "</mrow>", false, nil
+		}
+	}
+}
+
+func fence(d string) string {
+	if d == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + d + "</mo>"
+}
+
+type environment struct {
+	open, close string
+
+	// The alignment of the columns, repeated as needed.
+	align []string
+}
+
+var environments = map[string]environment{
+	"matrix":      {},
+	"smallmatrix": {},
+	"pmatrix":     {open: "(", close: ")"},
+	"bmatrix":     {open: "[", close: "]"},
+	"Bmatrix":     {open: "{", close: "}"},
+	"vmatrix":     {open: "|", close: "|"},
+	"Vmatrix":     {open: "‖", close: "‖"},
+	"cases":       {open: "{", align: []string{"left"}},
+	"array":       {},
+	"aligned":     {align: []string{"right", "left"}},
+	"align":       {align: []string{"right", "left"}},
+	"align*":      {align: []string{"right", "left"}},
+	"split":       {align: []string{"right", "left"}},
+	"gathered":    {},
+	"gather":      {},
+	"gather*":     {},
+	"equation":    {},
+	"equation*":   {},
+}
+
+func (p *mathParser) parseEnvironment() (string, bool, error) {
+	name, err := p.rawGroup()
+	if err != nil {
+		return "", false, err
+	}
+	env, ok := environments[name]
+	if !ok {
+		return "", false, fmt.Errorf("%w: environment %s", ErrUnsupported, name)
+	}
+	if name == "array" {
+		// The column specification is not used.
+		if _, err := p.rawGroup(); err != nil {
+			return "", false, err
+		}
+	}
+
+	var content string
+	if strings.HasPrefix(name, "equation") {
+		nodes, err := p.parseExprUntil("")
+		if err != nil {
+			return "", false, err
+		}
+		content = row(nodes)
+	} else {
+		content, err = p.parseTable(env)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	if t := p.next(); t.kind != tokCommand || t.value != "end" {
+		return "", false, p.unexpected(t)
+	}
+	end, err := p.rawGroup()
+	if err != nil {
+		return "", false, err
+	}
+	if end != name {
+		return "", false, fmt.Errorf("%w: \\begin{%s} ended by \\end{%s}", ErrUnsupported, name, end)
+	}
+
+	if env.open == "" && env.close == "" {
+		return content, false, nil
+	}
+	return "<mrow>" + fence(env.open) + content + fence(env.close) + "</mrow>", false, nil
+}
+
+// parseTable parses the rows and cells of an environment up to its \end.
+func (p *mathParser) parseTable(env environment) (string, error) {
+	var b strings.Builder
+	b.WriteString("<mtable>")
+	for {
+		var cells []string
+		for {
+			nodes, err := p.parseExprUntil("")
+			if err != nil {
+				return "", err
+			}
+			cells = append(cells, row(nodes))
+			if p.peek().kind != tokAmp {
+				break
+			}
+			p.next()
+		}
+
+		t := p.peek()
+		last := t.kind != tokNewline
+		if !last {
+			p.next()
+		}
+		// A trailing \\ before \end doesn't start a new row.
+		if !(len(cells) == 1 && cells[0] == "<mrow></mrow>" && last) {
+			b.WriteString("<mtr>")
+			for i, c := range cells {
+				if len(env.align) > 0 {
+					fmt.Fprintf(&b, `<mtd style="text-align: %s">`, env.align[i%len(env.align)])
+				} else {
+					b.WriteString("<mtd>")
+				}
+				b.WriteString(c)
+				b.WriteString("</mtd>")
+			}
+			b.WriteString("</mtr>")
+		}
+		if last {
+			if t.kind != tokCommand || t.value != "end" {
+				return "", p.unexpected(t)
+			}
+			b.WriteString("</mtable>")
+			return b.String(), nil
+		}
+	}
+}
+
+// ---- Elements ----
+
+func mi(s string) string {
+	return "<mi>" + html.EscapeString(s) + "</mi>"
+}
+
+func mn(s string) string {
+	return "<mn>" + html.EscapeString(s) + "</mn>"
+}
+
+func mo(s string) string {
+	return "<mo>" + html.EscapeString(s) + "</mo>"
+}
+
+// textEscapes unescapes the special characters in the argument of \text. A
+// double backslash is kept as is, so that it doesn't escape what follows.
+var textEscapes = strings.NewReplacer(
+	`\\`, `\\`,
+	`\$`, "$",
+	`\%`, "%",
+	`\#`, "#",
+	`\_`, "_",
+	`\{`, "{",
+	`\}`, "}",
+)
+
+// text collapses white space in the argument of \text, keeping leading and
+// trailing space as no-break spaces so that it is not trimmed in the output.
+func text(raw string) string {
+	s := strings.Join(strings.Fields(raw), " ")
+	if s == "" {
+		if raw != "" {
+			return "\u00a0"
+		}
+		return s
+	}
+	if unicode.IsSpace(rune(raw[0])) {
+		s = "\u00a0" + s
+	}
+	if unicode.IsSpace(rune(raw[len(raw)-1])) {
+		s += "\u00a0"
+	}
+	return s
+}
+
+// row returns nodes as a single node.
+func row(nodes []string) string {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
+
+// styled converts the argument of a font command such as \mathbf.
+func styled(raw string, v variant) (string, error) {
+	raw = strings.Join(strings.Fields(raw), "")
+	if strings.ContainsAny(raw, `\{}^_`) {
+		return "", fmt.Errorf("%w: markup in font command", ErrUnsupported)
+	}
+	if v.upright && utf8.RuneCountInString(raw) > 1 && strings.IndexFunc(raw, func(r rune) bool { return !unicode.IsLetter(r) }) == -1 {
+		// Multi-letter identifiers are upright, e.g. \mathrm{d}x or
+		// \mathrm{kg}.
+		return mi(raw), nil
+	}
+	var nodes []string
+	for _, r := range raw {
+		c := string(v.mapRune(r))
+		switch {
+		case unicode.IsDigit(r):
+			nodes = append(nodes, mn(c))
+		case unicode.IsLetter(r) && v.upright:
+			nodes = append(nodes, `<mi mathvariant="normal">`+html.EscapeString(c)+"</mi>")
+		case unicode.IsLetter(r):
+			nodes = append(nodes, mi(c))
+		default:
+			nodes = append(nodes, charNode(c))
+		}
+	}
+	return row(nodes), nil
+}
@@ -0,0 +1,166 @@
+package mathml
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gohugoio/hugo-goldmark-extensions/passthrough"
+	"github.com/yuin/goldmark"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestConvert(t *testing.T) {
+	c := qt.New(t)
+
+	for _, test := range []struct {
+		tex      string
+		expected string
+	}{
+		{`x^2+y_1`, `<mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><msub><mi>y</mi><mn>1</mn></msub></mrow>`},
+		{`x_i^{2n}`, `<msubsup><mi>x</mi><mi>i</mi><mrow><mn>2</mn><mi>n</mi></mrow></msubsup>`},
+		{`x^23`, `<mrow><msup><mi>x</mi><mn>2</mn></msup><mn>3</mn></mrow>`},
+		{`a-b`, `<mrow><mi>a</mi><mo>−</mo><mi>b</mi></mrow>`},
+		{`3.14`, `<mn>3.14</mn>`},
+		{`f'(x)`, `<mrow><msup><mi>f</mi><mo>′</mo></msup><mo stretchy="false">(</mo><mi>x</mi><mo stretchy="false">)</mo></mrow>`},
+		{`\frac{a}{b}`, `<mfrac><mi>a</mi><mi>b</mi></mfrac>`},
+		{`\frac12`, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{`\sqrt{x}`, `<msqrt><mi>x</mi></msqrt>`},
+		{`\sqrt[3]{x}`, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+		{`\alpha\Gamma`, `<mrow><mi>α</mi><mi mathvariant="normal">Γ</mi></mrow>`},
+		{`a \leq b`, `<mrow><mi>a</mi><mo>≤</mo><mi>b</mi></mrow>`},
+		{`a \not= b`, "<mrow><mi>a</mi><mo>≠</mo><mi>b</mi></mrow>"},
+		{`\sum_{i=1}^n i`, `<mrow><munderover><mo movablelimits="true">∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi></mrow>`},
+		{`\int_0^1`, `<msubsup><mo>∫</mo><mn>0</mn><mn>1</mn></msubsup>`},
+		{`\lim_{x\to 0}`, `<munder><mo form="prefix" movablelimits="true">lim</mo><mrow><mi>x</mi><mo>→</mo><mn>0</mn></mrow></munder>`},
+		{`\sin x`, `<mrow><mi>sin</mi><mi>x</mi></mrow>`},
+		{`\hat{x}`, `<mover accent="true"><mi>x</mi><mo>^</mo></mover>`},
+		{`\text{if } x`, "<mrow><mtext>if </mtext><mi>x</mi></mrow>"},
+		{`\mathbb{R}\mathbf{x}`, `<mrow><mi>ℝ</mi><mi>𝐱</mi></mrow>`},
+		{`\mathrm{d}x`, `<mrow><mi mathvariant="normal">d</mi><mi>x</mi></mrow>`},
+		{`a\,b`, `<mrow><mi>a</mi><mspace width="0.1667em"></mspace><mi>b</mi></mrow>`},
+		{`\left(\frac{1}{2}\right)`, `<mrow><mo fence="true" stretchy="true">(</mo><mfrac><mn>1</mn><mn>2</mn></mfrac><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\left.x\right|`, `<mrow><mi>x</mi><mo fence="true" stretchy="true">|</mo></mrow>`},
+		{`a<b`, `<mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow>`},
+		{`\begin{pmatrix}a & b\\ c & d\end{pmatrix}`, `<mrow><mo fence="true" stretchy="true">(</mo><mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr><mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\begin{aligned}a &= b \\ \end{aligned}`, `<mtable><mtr><mtd style="text-align: right"><mi>a</mi></mtd><mtd style="text-align: left"><mrow><mo>=</mo><mi>b</mi></mrow></mtd></mtr></mtable>`},
+		{`\begin{cases}1 & x>0\end{cases}`, `<mrow><mo fence="true" stretchy="true">{</mo><mtable><mtr><mtd style="text-align: left"><mn>1</mn></mtd><mtd style="text-align: left"><mrow><mi>x</mi><mo>&gt;</mo><mn>0</mn></mrow></mtd></mtr></mtable></mrow>`},
+		{`x % comment`, `<mi>x</mi>`},
+	} {
+		got, err := Convert([]byte(test.tex), false)
+		c.Assert(err, qt.IsNil, qt.Commentf(test.tex))
+		c.Assert(got, qt.Equals, "<math>"+test.expected+"</math>", qt.Commentf(test.tex))
+	}
+}
+
+func TestConvertDisplay(t *testing.T) {
+	c := qt.New(t)
+
+	got, err := Convert([]byte("x"), true)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.Equals, `<math display="block"><mi>x</mi></math>`)
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	c := qt.New(t)
+
+	for _, tex := range []string{
+		`\foo`,
+		`\frac{a}`,
+		`{x`,
+		`x}`,
+		`a & b`,
+		`a \\ b`,
+		`x^1^2`,
+		`\begin{tabular}x\end{tabular}`,
+		`\begin{matrix}x\end{pmatrix}`,
+		`\left(x`,
+		`\mathbf{\alpha}`,
+		strings.Repeat("{", 1000) + strings.Repeat("}", 1000),
+		strings.Repeat(`\hat`, 1000) + "x",
+		strings.Repeat(`\sqrt`, 1000) + "x",
+		strings.Repeat(`\frac1`, 1000) + "x",
+		strings.Repeat(`\not`, 1000) + "=",
+	} {
+		_, err := Convert([]byte(tex), false)
+		c.Assert(errors.Is(err, ErrUnsupported), qt.IsTrue, qt.Commentf(tex))
+	}
+}
+
+func render(c *qt.C, conf Config, input string) string {
+	c.Helper()
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			passthrough.New(
+				passthrough.Config{
+					InlineDelimiters: []passthrough.Delimiters{{Open: "$", Close: "$"}, {Open: "\\(", Close: "\\)", Name: "chem"}},
+					BlockDelimiters:  []passthrough.Delimiters{{Open: "$$", Close: "$$"}},
+					Environments:     []string{"align"},
+					Renderer:         New(conf),
+				},
+			)),
+	)
+	var buf bytes.Buffer
+	c.Assert(md.Convert([]byte(input), &buf), qt.IsNil)
+	return strings.TrimSpace(buf.String())
+}
+
+func TestRenderer(t *testing.T) {
+	c := qt.New(t)
+
+	input := `Inline $x^2$, \(H_2O\), $\foo$ and $$y$$.
+
+$$
+\frac{a}{b}
+$$
+
+\begin{align}
+a &= b
+\end{align}`
+	expected := `<p>Inline <math><msup><mi>x</mi><mn>2</mn></msup></math>, <math><mrow><msub><mi>H</mi><mn>2</mn></msub><mi>O</mi></mrow></math>, $\foo$ and </p>
+<math display="block"><mi>y</mi></math>
+<p>.</p>
+<math display="block"><mfrac><mi>a</mi><mi>b</mi></mfrac></math>
+<math display="block"><mtable><mtr><mtd style="text-align: right"><mi>a</mi></mtd><mtd style="text-align: left"><mrow><mo>=</mo><mi>b</mi></mrow></mtd></mtr></mtable></math>`
+	c.Assert(render(c, Config{}, input), qt.Equals, expected)
+}
+
+func TestRendererNames(t *testing.T) {
+	c := qt.New(t)
+
+	input := `$x$ and \(H_2O\)`
+	expected := `<p><math><mi>x</mi></math> and \(H_2O\)</p>`
+	c.Assert(render(c, Config{Names: []string{""}}, input), qt.Equals, expected)
+}
+
+func TestRendererNamesEnvironment(t *testing.T) {
+	c := qt.New(t)
+
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			passthrough.New(
+				passthrough.Config{
+					BlockDelimiters: []passthrough.Delimiters{{Open: "$$", Close: "$$", Name: "math"}},
+					Environments:    []string{"align"},
+					Renderer:        New(Config{Names: []string{"math"}}),
+				},
+			)),
+	)
+	input := `\begin{align}
+a &= b
+\end{align}`
+	expected := `<math display="block"><mtable><mtr><mtd style="text-align: right"><mi>a</mi></mtd><mtd style="text-align: left"><mrow><mo>=</mo><mi>b</mi></mrow></mtd></mtr></mtable></math>`
+	var buf bytes.Buffer
+	c.Assert(md.Convert([]byte(input), &buf), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, expected)
+}
+
+func TestRendererAnnotate(t *testing.T) {
+	c := qt.New(t)
+
+	input := `$a<b$`
+	expected := `<p><math><semantics><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow><annotation encoding="application/x-tex">a&lt;b</annotation></semantics></math></p>`
+	c.Assert(render(c, Config{Annotate: true}, input), qt.Equals, expected)
+}
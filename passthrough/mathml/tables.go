@@ -0,0 +1,188 @@
+package mathml
+
+import "html"
+
+// symbol is a command that produces a single element.
+type symbol struct {
+	text string
+
+	// Whether the symbol is an operator rather than an identifier.
+	op bool
+
+	// Whether scripts on the symbol are placed as limits.
+	limits bool
+}
+
+func (s symbol) node() string {
+	if s.op {
+		if s.limits {
+			return `<mo movablelimits="true">` + html.EscapeString(s.text) + "</mo>"
+		}
+		return mo(s.text)
+	}
+	for _, r := range s.text {
+		if r >= 'Α' && r <= 'Ω' {
+			// Capital Greek letters are upright.
+			return `<mi mathvariant="normal">` + s.text + "</mi>"
+		}
+	}
+	return mi(s.text)
+}
+
+var symbols = map[string]symbol{
+	// Greek letters.
+	"alpha": {text: "α"}, "beta": {text: "β"}, "gamma": {text: "γ"}, "delta": {text: "δ"},
+	"epsilon": {text: "ϵ"}, "varepsilon": {text: "ε"}, "zeta": {text: "ζ"}, "eta": {text: "η"},
+	"theta": {text: "θ"}, "vartheta": {text: "ϑ"}, "iota": {text: "ι"}, "kappa": {text: "κ"},
+	"lambda": {text: "λ"}, "mu": {text: "μ"}, "nu": {text: "ν"}, "xi": {text: "ξ"},
+	"omicron": {text: "ο"}, "pi": {text: "π"}, "varpi": {text: "ϖ"}, "rho": {text: "ρ"},
+	"varrho": {text: "ϱ"}, "sigma": {text: "σ"}, "varsigma": {text: "ς"}, "tau": {text: "τ"},
+	"upsilon": {text: "υ"}, "phi": {text: "ϕ"}, "varphi": {text: "φ"}, "chi": {text: "χ"},
+	"psi": {text: "ψ"}, "omega": {text: "ω"},
+	"Gamma": {text: "Γ"}, "Delta": {text: "Δ"}, "Theta": {text: "Θ"}, "Lambda": {text: "Λ"},
+	"Xi": {text: "Ξ"}, "Pi": {text: "Π"}, "Sigma": {text: "Σ"}, "Upsilon": {text: "Υ"},
+	"Phi": {text: "Φ"}, "Psi": {text: "Ψ"}, "Omega": {text: "Ω"},
+
+	// Other identifiers.
+	"infty": {text: "∞"}, "partial": {text: "∂"}, "nabla": {text: "∇"}, "ell": {text: "ℓ"},
+	"hbar": {text: "ℏ"}, "imath": {text: "ı"}, "jmath": {text: "ȷ"}, "Re": {text: "ℜ"},
+	"Im": {text: "ℑ"}, "aleph": {text: "ℵ"}, "wp": {text: "℘"}, "emptyset": {text: "∅"},
+	"varnothing": {text: "∅"}, "%": {text: "%"}, "$": {text: "$"}, "#": {text: "#"},
+	"_": {text: "_"},
+
+	// Binary operators.
+	"pm": {text: "±", op: true}, "mp": {text: "∓", op: true}, "times": {text: "×", op: true},
+	"div": {text: "÷", op: true}, "cdot": {text: "⋅", op: true}, "ast": {text: "∗", op: true},
+	"star": {text: "⋆", op: true}, "circ": {text: "∘", op: true}, "bullet": {text: "∙", op: true},
+	"oplus": {text: "⊕", op: true}, "ominus": {text: "⊖", op: true}, "otimes": {text: "⊗", op: true},
+	"odot": {text: "⊙", op: true}, "cup": {text: "∪", op: true}, "cap": {text: "∩", op: true},
+	"setminus": {text: "∖", op: true}, "wedge": {text: "∧", op: true}, "land": {text: "∧", op: true},
+	"vee": {text: "∨", op: true}, "lor": {text: "∨", op: true}, "neg": {text: "¬", op: true},
+	"lnot": {text: "¬", op: true}, "&": {text: "&", op: true},
+
+	// Relations.
+	"leq": {text: "≤", op: true}, "le": {text: "≤", op: true}, "geq": {text: "≥", op: true},
+	"ge": {text: "≥", op: true}, "neq": {text: "≠", op: true}, "ne": {text: "≠", op: true},
+	"ll": {text: "≪", op: true}, "gg": {text: "≫", op: true}, "approx": {text: "≈", op: true},
+	"equiv": {text: "≡", op: true}, "sim": {text: "∼", op: true}, "simeq": {text: "≃", op: true},
+	"cong": {text: "≅", op: true}, "propto": {text: "∝", op: true}, "in": {text: "∈", op: true},
+	"notin": {text: "∉", op: true}, "ni": {text: "∋", op: true}, "subset": {text: "⊂", op: true},
+	"supset": {text: "⊃", op: true}, "subseteq": {text: "⊆", op: true}, "supseteq": {text: "⊇", op: true},
+	"mid": {text: "∣", op: true}, "parallel": {text: "∥", op: true}, "perp": {text: "⊥", op: true},
+	"models": {text: "⊨", op: true}, "vdash": {text: "⊢", op: true},
+
+	// Arrows.
+	"to": {text: "→", op: true}, "rightarrow": {text: "→", op: true}, "leftarrow": {text: "←", op: true},
+	"gets": {text: "←", op: true}, "leftrightarrow": {text: "↔", op: true}, "Rightarrow": {text: "⇒", op: true},
+	"Leftarrow": {text: "⇐", op: true}, "Leftrightarrow": {text: "⇔", op: true}, "iff": {text: "⟺", op: true},
+	"implies": {text: "⟹", op: true}, "impliedby": {text: "⟸", op: true}, "mapsto": {text: "↦", op: true},
+	"longrightarrow": {text: "⟶", op: true}, "longleftarrow": {text: "⟵", op: true},
+	"longleftrightarrow": {text: "⟷", op: true}, "Longrightarrow": {text: "⟹", op: true},
+	"Longleftarrow": {text: "⟸", op: true}, "Longleftrightarrow": {text: "⟺", op: true},
+	"uparrow": {text: "↑", op: true}, "downarrow": {text: "↓", op: true},
+
+	// Punctuation and delimiters.
+	"{": {text: "{", op: true}, "}": {text: "}", op: true}, "|": {text: "‖", op: true},
+	"langle": {text: "⟨", op: true}, "rangle": {text: "⟩", op: true}, "lfloor": {text: "⌊", op: true},
+	"rfloor": {text: "⌋", op: true}, "lceil": {text: "⌈", op: true}, "rceil": {text: "⌉", op: true},
+	"vert": {text: "|", op: true}, "Vert": {text: "‖", op: true}, "ldots": {text: "…", op: true},
+	"dots": {text: "…", op: true}, "cdots": {text: "⋯", op: true}, "vdots": {text: "⋮", op: true},
+	"ddots": {text: "⋱", op: true}, "forall": {text: "∀", op: true}, "exists": {text: "∃", op: true},
+	"nexists": {text: "∄", op: true}, "prime": {text: "′", op: true}, "angle": {text: "∠", op: true},
+	"triangle": {text: "△", op: true}, "colon": {text: ":", op: true},
+
+	// Large operators.
+	"sum": {text: "∑", op: true, limits: true}, "prod": {text: "∏", op: true, limits: true},
+	"coprod": {text: "∐", op: true, limits: true}, "bigcup": {text: "⋃", op: true, limits: true},
+	"bigcap": {text: "⋂", op: true, limits: true}, "bigoplus": {text: "⨁", op: true, limits: true},
+	"bigotimes": {text: "⨂", op: true, limits: true}, "bigvee": {text: "⋁", op: true, limits: true},
+	"bigwedge": {text: "⋀", op: true, limits: true},
+	"int":      {text: "∫", op: true}, "iint": {text: "∬", op: true}, "iiint": {text: "∭", op: true},
+	"oint": {text: "∮", op: true},
+}
+
+// functions maps function names to whether scripts on them are placed as
+// limits.
+var functions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false,
+	"tanh": false, "coth": false, "log": false, "ln": false, "lg": false, "exp": false,
+	"deg": false, "dim": false, "ker": false, "arg": false, "hom": false,
+	"lim": true, "liminf": true, "limsup": true, "max": true, "min": true, "sup": true,
+	"inf": true, "det": true, "gcd": true, "Pr": true,
+}
+
+var spaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", "!": "-0.1667em",
+	" ": "0.3333em", "quad": "1em", "qquad": "2em", "thinspace": "0.1667em",
+	"medspace": "0.2222em", "thickspace": "0.2778em",
+}
+
+type accent struct {
+	char  string
+	under bool
+}
+
+var accents = map[string]accent{
+	"hat": {char: "^"}, "widehat": {char: "^"}, "bar": {char: "¯"}, "overline": {char: "‾"},
+	"vec": {char: "→"}, "overrightarrow": {char: "→"}, "overleftarrow": {char: "←"},
+	"dot": {char: "˙"}, "ddot": {char: "¨"}, "tilde": {char: "~"}, "widetilde": {char: "~"},
+	"check": {char: "ˇ"}, "breve": {char: "˘"}, "acute": {char: "´"}, "grave": {char: "`"},
+	"overbrace": {char: "⏞"}, "underbrace": {char: "⏟", under: true},
+	"underline": {char: "_", under: true},
+}
+
+var delimiters = map[string]string{
+	"{": "{", "}": "}", "|": "‖", "langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖", "lvert": "|", "rvert": "|",
+	"lVert": "‖", "rVert": "‖", "uparrow": "↑", "downarrow": "↓", "backslash": "∖",
+}
+
+// variant maps letters and digits to a Unicode mathematical alphabet, which
+// is how MathML Core styles identifiers.
+type variant struct {
+	upright bool
+
+	// The code points for A, a and 0, or zero to keep them as is.
+	upper, lower, digit rune
+
+	// Letters that live outside the mathematical alphanumeric block.
+	exceptions map[rune]rune
+}
+
+func (v variant) mapRune(r rune) rune {
+	if c, ok := v.exceptions[r]; ok {
+		return c
+	}
+	switch {
+	case r >= 'A' && r <= 'Z' && v.upper != 0:
+		return v.upper + r - 'A'
+	case r >= 'a' && r <= 'z' && v.lower != 0:
+		return v.lower + r - 'a'
+	case r >= '0' && r <= '9' && v.digit != 0:
+		return v.digit + r - '0'
+	}
+	return r
+}
+
+var fonts = map[string]variant{
+	"mathrm":     {upright: true},
+	"mathit":     {},
+	"mathbf":     {upper: 0x1D400, lower: 0x1D41A, digit: 0x1D7CE},
+	"boldsymbol": {upper: 0x1D468, lower: 0x1D482, digit: 0x1D7CE},
+	"mathsf":     {upper: 0x1D5A0, lower: 0x1D5BA, digit: 0x1D7E2},
+	"mathtt":     {upper: 0x1D670, lower: 0x1D68A, digit: 0x1D7F6},
+	"mathbb": {upper: 0x1D538, lower: 0x1D552, digit: 0x1D7D8, exceptions: map[rune]rune{
+		'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ',
+	}},
+	"mathcal": script,
+	"mathscr": script,
+	"mathfrak": {upper: 0x1D504, lower: 0x1D51E, exceptions: map[rune]rune{
+		'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ',
+	}},
+}
+
+var script = variant{upper: 0x1D49C, lower: 0x1D4B6, exceptions: map[rune]rune{
+	'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+	'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ',
+}}
@@ -2,20 +2,169 @@ package passthrough
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
 )
 
+// Delimiters is a pair of opening and closing delimiters.
 type Delimiters struct {
 	Open  string
 	Close string
+
+	// Name is an optional name for the class of content these delimiters
+	// enclose, e.g. "math" or "chem". It is available on the parsed nodes so
+	// that renderers can handle each class differently.
+	Name string
+
+	// Nested enables matching of nested delimiter pairs, so that e.g.
+	// \(a \text{\(b\)}\) is one passthrough rather than ending at the first
+	// \). Delimiters preceded by an odd number of backslashes are not
+	// counted. Nested has no effect if Open and Close are equal.
+	Nested bool
+
+	// Constraints restrict where these delimiters may open and close a
+	// passthrough.
+	Constraints Constraints
+
+	// Output configures how text enclosed by these delimiters is rendered
+	// when no Renderer handles it. The zero value renders the text as is,
+	// including the delimiters.
+	Output Output
+}
+
+// Constraints restrict where delimiters may open and close a passthrough. They
+// help avoid false matches for delimiters that also appear in ordinary text,
+// such as $ in "costs $5 and $10".
+type Constraints struct {
+	// NoSpaceAfterOpen requires that the opening delimiter is immediately
+	// followed by a non-space character.
+	NoSpaceAfterOpen bool
+
+	// NoSpaceBeforeClose requires that the closing delimiter is immediately
+	// preceded by a non-space character on the same line.
+	NoSpaceBeforeClose bool
+
+	// NoDigitAfterClose requires that the closing delimiter is not
+	// immediately followed by a digit.
+	NoDigitAfterClose bool
+}
+
+// PandocConstraints are the rules of Pandoc's tex_math_dollars extension for
+// the $ delimiter.
+var PandocConstraints = Constraints{
+	NoSpaceAfterOpen:   true,
+	NoSpaceBeforeClose: true,
+	NoDigitAfterClose:  true,
+}
+
+// canOpen reports whether an opening delimiter followed by b is allowed.
+func (c Constraints) canOpen(b []byte) bool {
+	return !c.NoSpaceAfterOpen || (len(b) > 0 && !util.IsSpace(b[0]))
+}
+
+// canClose reports whether a closing delimiter of length n at b[i] is
+// allowed.
+func (c Constraints) canClose(b []byte, i, n int) bool {
+	if c.NoSpaceBeforeClose && (i == 0 || util.IsSpace(b[i-1])) {
+		return false
+	}
+	if c.NoDigitAfterClose && i+n < len(b) && b[i+n] >= '0' && b[i+n] <= '9' {
+		return false
+	}
+	return true
+}
+
+// Output configures the default HTML output of a passthrough.
+type Output struct {
+	// Element is the name of an HTML element to wrap the passthrough in, e.g.
+	// "span" or "div". If empty, the passthrough is not wrapped.
+	Element string
+
+	// Class is the class attribute of the wrapper element, e.g.
+	// "math inline". It is ignored if Element is empty.
+	Class string
+
+	// StripDelimiters removes the delimiters from the output.
+	StripDelimiters bool
+
+	// Escape controls HTML escaping of the passthrough text.
+	Escape EscapeMode
+}
+
+// EscapeMode controls HTML escaping of passthrough text.
+type EscapeMode int
+
+const (
+	// EscapeNone writes the passthrough text as is.
+	EscapeNone EscapeMode = iota
+
+	// EscapeHTML escapes <, >, & and " in the passthrough text, so that
+	// browsers don't interpret e.g. $a<b$ as the start of an element.
+	EscapeHTML
+
+	// EscapeHTMLUnlessUnsafe escapes the passthrough text like EscapeHTML,
+	// unless raw HTML is allowed with html.WithUnsafe.
+	EscapeHTMLUnlessUnsafe
+)
+
+// escape reports whether passthrough text should be escaped with the given
+// HTML renderer configuration.
+func (o Output) escape(c html.Config) bool {
+	switch o.Escape {
+	case EscapeHTML:
+		return true
+	case EscapeHTMLUnlessUnsafe:
+		return !c.Unsafe
+	default:
+		return false
+	}
+}
+
+// closingDelimiterIndex returns the index of the closing delimiter in b, or -1
+// if there is none. depth is the number of nested openers that are still open
+// at the start of b, and the returned depth is the number still open at the
+// end of b. Both are always zero unless d.Nested is set.
+func (d *Delimiters) closingDelimiterIndex(b []byte, depth int) (int, int) {
+	nested := d.Nested && d.Open != d.Close
+	if !nested && d.Constraints == (Constraints{}) {
+		return bytes.Index(b, []byte(d.Close)), depth
+	}
+	for i := 0; i < len(b); i++ {
+		switch {
+		case startsWith(b[i:], d.Close) && !(nested && isEscaped(b, i)) && d.Constraints.canClose(b, i, len(d.Close)):
+			if depth == 0 {
+				return i, depth
+			}
+			depth--
+			i += len(d.Close) - 1
+		case nested && startsWith(b[i:], d.Open) && !isEscaped(b, i):
+			depth++
+			i += len(d.Open) - 1
+		}
+	}
+	return -1, depth
+}
+
+// isEscaped reports whether b[i] is preceded by an odd number of backslashes.
+func isEscaped(b []byte, i int) bool {
+	n := 0
+	for i > 0 && b[i-1] == '\\' {
+		n++
+		i--
+	}
+	return n%2 == 1
 }
 
 // Determine if a byte array starts with a given string
@@ -34,8 +183,19 @@ type PassthroughInline struct {
 	// The segment of text that this inline passthrough represents.
 	Segment text.Segment
 
+	// The segments of the lines of a passthrough that spans several lines.
+	// Unlike Segment, they exclude the prefixes of containers such as
+	// blockquotes and list items. Nil for a passthrough on a single line.
+	LineSegments []text.Segment
+
 	// The matched delimiters
 	Delimiters *Delimiters
+
+	// Start is the position of the opening delimiter and End the position
+	// just after the closing delimiter, or the fences of a fenced code
+	// block. They are set once the document is parsed.
+	Start Position
+	End   Position
 }
 
 func newPassthroughInline(segment text.Segment, delimiters *Delimiters) *PassthroughInline {
@@ -48,7 +208,29 @@ func newPassthroughInline(segment text.Segment, delimiters *Delimiters) *Passthr
 // Text implements Node.Text.
 // Deprecated: Goldmark v1.7.8 deprecates Node.Text
 func (n *PassthroughInline) Text(source []byte) []byte {
-	return n.Segment.Value(source)
+	return n.Value(source)
+}
+
+// Value returns the text of the passthrough, including its delimiters but
+// without container prefixes.
+func (n *PassthroughInline) Value(source []byte) []byte {
+	if n.LineSegments == nil {
+		return n.Segment.Value(source)
+	}
+	var b []byte
+	for _, seg := range n.LineSegments {
+		b = append(b, seg.Value(source)...)
+	}
+	return b
+}
+
+// Name returns the name of the matched delimiters, or an empty string if
+// they have none.
+func (n *PassthroughInline) Name() string {
+	if n.Delimiters == nil {
+		return ""
+	}
+	return n.Delimiters.Name
 }
 
 // Dump implements Node.Dump.
@@ -56,7 +238,14 @@ func (n *PassthroughInline) Dump(source []byte, level int) {
 	indent := strings.Repeat("    ", level)
 	fmt.Printf("%sPassthroughInline {\n", indent)
 	indent2 := strings.Repeat("    ", level+1)
-	fmt.Printf("%sSegment: \"%s\"\n", indent2, n.Segment.Value(source))
+	fmt.Printf("%sSegment: \"%s\"\n", indent2, n.Value(source))
+	if name := n.Name(); name != "" {
+		fmt.Printf("%sName: \"%s\"\n", indent2, name)
+	}
+	if n.Start.IsValid() {
+		fmt.Printf("%sStart: %s\n", indent2, n.Start)
+		fmt.Printf("%sEnd: %s\n", indent2, n.End)
+	}
 	fmt.Printf("%s}\n", indent)
 }
 
@@ -78,11 +267,12 @@ func newInlinePassthroughParser(ds []Delimiters) parser.InlineParser {
 	}
 }
 
-// Determine if the input slice starts with a full valid opening delimiter.
-// If so, returns the delimiter struct, otherwise returns nil.
+// Determine if the input slice starts with a full valid opening delimiter,
+// allowed by the delimiter's constraints. If so, returns the delimiter struct,
+// otherwise returns nil.
 func getFullOpeningDelimiter(delims []Delimiters, line []byte) *Delimiters {
 	for _, d := range delims {
-		if startsWith(line, d.Open) {
+		if startsWith(line, d.Open) && d.Constraints.canOpen(line[len(d.Open):]) {
 			return &d
 		}
 	}
@@ -229,16 +419,29 @@ func (s *inlinePassthroughParser) Parse(parent ast.Node, block text.Reader, pc p
 	block.Advance(len(fencePair.Open))
 	openerSize := len(fencePair.Open)
 	l, pos := block.Position()
+	depth := 0
+	lastStop := startSegment.Stop
+	var lines []text.Segment
 
 	for {
 		line, lineSegment := block.PeekLine()
+		// The first line starts at the opening delimiter.
+		lineStart := lineSegment
+		if lines == nil {
+			lineStart = startSegment
+		}
 		if line == nil {
+			kind := unclosedKind(s.PassthroughDelimiters, block.Source(), fencePair, lastStop, depth)
+			addDiagnostic(pc, block.Source(), kind, fencePair, startSegment.Start)
 			block.SetPosition(l, pos)
 			return ast.NewTextSegment(startSegment.WithStop(startSegment.Start + openerSize))
 		}
+		lastStop = lineSegment.Stop
 
-		closingDelimiterPos := bytes.Index(line, []byte(fencePair.Close))
+		var closingDelimiterPos int
+		closingDelimiterPos, depth = fencePair.closingDelimiterIndex(line, depth)
 		if closingDelimiterPos == -1 { // no closer on this line
+			lines = append(lines, lineStart.WithStop(lineSegment.Stop))
 			block.AdvanceLine()
 			continue
 		}
@@ -246,16 +449,225 @@ func (s *inlinePassthroughParser) Parse(parent ast.Node, block text.Reader, pc p
 		// This segment spans from the original starting trigger (including the delimiter)
 		// up to and including the closing delimiter.
 		seg := startSegment.WithStop(lineSegment.Start + closingDelimiterPos + len(fencePair.Close))
+		block.Advance(closingDelimiterPos + len(fencePair.Close))
 		if seg.Len() == len(fencePair.Open)+len(fencePair.Close) {
-			return nil
+			// Empty passthroughs are left as text, including both
+			// delimiters so that they aren't parsed again.
+			addDiagnostic(pc, block.Source(), DiagnosticEmpty, fencePair, startSegment.Start)
+			return ast.NewTextSegment(seg)
 		}
+		n := newPassthroughInline(seg, fencePair)
+		if lines != nil {
+			n.LineSegments = append(lines, lineStart.WithStop(seg.Stop))
+		}
+		return n
+	}
+}
 
-		block.Advance(closingDelimiterPos + len(fencePair.Close))
-		return newPassthroughInline(seg, fencePair)
+// ErrUseDefault can be returned by a Renderer to have the passthrough rendered
+// as is, with its delimiters. A Renderer returning ErrUseDefault must not
+// write anything to w.
+var ErrUseDefault = errors.New("passthrough: use default rendering")
+
+// Renderer renders the content of passthrough nodes, e.g. to pre-render math
+// at build time. Errors other than ErrUseDefault are returned from the
+// goldmark Convert or Render call.
+type Renderer interface {
+	// RenderInline renders a PassthroughInline node.
+	RenderInline(w util.BufWriter, ctx RenderContext) error
+
+	// RenderBlock renders a PassthroughBlock node.
+	RenderBlock(w util.BufWriter, ctx RenderContext) error
+}
+
+// RenderContext holds the information passed to a Renderer.
+type RenderContext struct {
+	// The node being rendered, a *PassthroughInline or a *PassthroughBlock.
+	Node ast.Node
+
+	// The document source.
+	Source []byte
+
+	// The passthrough content without delimiters.
+	Content []byte
+
+	// The matched delimiters. Renderers can use Delimiters.Name to handle
+	// each class of content differently.
+	Delimiters *Delimiters
+
+	// Whether the content was delimited by block delimiters. This is true
+	// for all PassthroughBlock nodes, and for PassthroughInline nodes that
+	// use block delimiters in a context that can't be split into blocks,
+	// such as a heading.
+	Display bool
+}
+
+// trimDelimiters returns b without the opening and closing delimiters.
+func trimDelimiters(b []byte, d *Delimiters) []byte {
+	if len(b) < len(d.Open)+len(d.Close) {
+		return nil
+	}
+	return b[len(d.Open) : len(b)-len(d.Close)]
+}
+
+// renderDefault writes value, the passthrough text including its delimiters,
+// as configured by d.Output and the HTML renderer configuration c.
+// If n has attributes, the passthrough is wrapped in an element even if
+// d.Output has none, using defaultElement.
+func renderDefault(w util.BufWriter, value []byte, d *Delimiters, n ast.Node, c html.Config, defaultElement string) {
+	o := d.Output
+	if o.StripDelimiters {
+		value = trimDelimiters(value, d)
+	}
+	if o.escape(c) {
+		value = util.EscapeHTML(value)
+	}
+	element := o.Element
+	if element == "" && n.Attributes() != nil {
+		element = defaultElement
+	}
+	if element != "" {
+		_ = w.WriteByte('<')
+		_, _ = w.WriteString(element)
+		renderAttributes(w, o.Class, n)
+		_ = w.WriteByte('>')
+	}
+	_, _ = w.Write(value)
+	if element != "" {
+		_, _ = w.WriteString("</")
+		_, _ = w.WriteString(element)
+		_ = w.WriteByte('>')
+	}
+}
+
+var attrNameClass = []byte("class")
+
+// passthroughAttributeFilter is a global filter for attributes.
+var passthroughAttributeFilter = html.GlobalAttributeFilter
+
+// renderAttributes writes the attributes of n, with class prepended to the
+// class attribute of n.
+func renderAttributes(w util.BufWriter, class string, n ast.Node) {
+	classes := []byte(class)
+	if v, ok := n.Attribute(attrNameClass); ok {
+		if v, ok := v.([]byte); ok && len(v) > 0 {
+			if len(classes) > 0 {
+				classes = append(classes, ' ')
+			}
+			classes = append(classes, v...)
+		}
+	}
+	if len(classes) > 0 {
+		_, _ = w.WriteString(` class="`)
+		_, _ = w.Write(util.EscapeHTML(classes))
+		_ = w.WriteByte('"')
+	}
+	for _, attr := range n.Attributes() {
+		if bytes.Equal(attr.Name, attrNameClass) {
+			continue
+		}
+		if !passthroughAttributeFilter.Contains(attr.Name) && !bytes.HasPrefix(attr.Name, []byte("data-")) {
+			continue
+		}
+		_ = w.WriteByte(' ')
+		_, _ = w.Write(attr.Name)
+		_, _ = w.WriteString(`="`)
+		switch v := attr.Value.(type) {
+		case []byte:
+			_, _ = w.Write(util.EscapeHTML(v))
+		case string:
+			_, _ = w.Write(util.EscapeHTML([]byte(v)))
+		default:
+			_, _ = w.Write(util.EscapeHTML([]byte(fmt.Sprint(v))))
+		}
+		_ = w.WriteByte('"')
 	}
 }
 
-type passthroughInlineRenderer struct{}
+// parseLeadingAttributes parses an attribute list, such as {#id .class}, at
+// the start of b after optional spaces. It returns the attributes and the
+// number of bytes they span, if the list is followed by a space or the end
+// of b.
+func parseLeadingAttributes(b []byte) (parser.Attributes, int, bool) {
+	r := text.NewReader(b)
+	attrs, ok := parser.ParseAttributes(r)
+	if !ok {
+		return nil, 0, false
+	}
+	_, pos := r.Position()
+	if pos.Start < len(b) && !util.IsSpace(b[pos.Start]) {
+		return nil, 0, false
+	}
+	return attrs, pos.Start, true
+}
+
+// parseTrailingAttributes parses an attribute list, such as {#id .class},
+// that makes up all of b apart from spaces.
+func parseTrailingAttributes(b []byte) (parser.Attributes, bool) {
+	attrs, n, ok := parseLeadingAttributes(b)
+	if !ok || !util.IsBlank(b[n:]) {
+		return nil, false
+	}
+	return attrs, true
+}
+
+// setAttributes sets attrs on n, and registers an id attribute so that
+// generated heading ids don't collide with it.
+func setAttributes(n ast.Node, attrs parser.Attributes, pc parser.Context) {
+	putIDs(attrs, pc)
+	for _, attr := range attrs {
+		n.SetAttribute(attr.Name, attr.Value)
+	}
+}
+
+// putIDs registers the id attribute in attrs, if any. Heading ids are
+// generated while the blocks are parsed, so ids must be registered by then.
+func putIDs(attrs parser.Attributes, pc parser.Context) {
+	for _, attr := range attrs {
+		if id, ok := attr.Value.([]byte); ok && string(attr.Name) == "id" {
+			pc.IDs().Put(id)
+		}
+	}
+}
+
+// attributeIDTransformer registers the ids of the attribute lists that
+// follow block passthroughs in the middle of paragraphs. Those are only set
+// by passthroughInlineTransformer once the whole document is parsed, after
+// the ids of later headings have been generated.
+type attributeIDTransformer struct {
+	inlineDelims []Delimiters
+	blockDelims  []Delimiters
+}
+
+func newAttributeIDTransformer(inlineDelims, blockDelims []Delimiters) parser.ParagraphTransformer {
+	return &attributeIDTransformer{inlineDelims: inlineDelims, blockDelims: blockDelims}
+}
+
+// Transform implements parser.ParagraphTransformer.
+func (t *attributeIDTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var b []byte
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b = append(b, seg.Value(source)...)
+	}
+	for _, span := range passthroughSpans(t.inlineDelims, b) {
+		d := getFullOpeningDelimiter(t.inlineDelims, b[span[0]:])
+		if !containsDelimiters(t.blockDelims, d) {
+			continue
+		}
+		if attrs, _, ok := parseLeadingAttributes(b[span[1]:]); ok {
+			putIDs(attrs, pc)
+		}
+	}
+}
+
+type passthroughInlineRenderer struct {
+	html.Config
+	renderer        Renderer
+	blockDelimiters []Delimiters
+}
 
 func (r *passthroughInlineRenderer) renderRawInline(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
 	if entering {
@@ -263,24 +675,103 @@ func (r *passthroughInlineRenderer) renderRawInline(w util.BufWriter, source []b
 		if !ok {
 			return ast.WalkContinue, nil
 		}
-		w.WriteString(string(n.Segment.Value(source)))
+		value := n.Value(source)
+		if r.renderer != nil {
+			err := r.renderer.RenderInline(w, RenderContext{
+				Node:       n,
+				Source:     source,
+				Content:    trimDelimiters(value, n.Delimiters),
+				Delimiters: n.Delimiters,
+				Display:    containsDelimiters(r.blockDelimiters, n.Delimiters),
+			})
+			if !errors.Is(err, ErrUseDefault) {
+				return ast.WalkContinue, err
+			}
+		}
+		renderDefault(w, value, n.Delimiters, n, r.Config, "span")
 	}
 	return ast.WalkContinue, nil
 }
 
 // A PassthroughBlock struct represents a fenced block of raw text to pass
-// through unchanged. This is not parsed directly, but emitted by an
-// ASTTransformer that splits a paragraph at the point of an inline passthrough
-// with the matching block delimiters.
+// through unchanged. Blocks whose opening delimiter starts a line are parsed
+// directly by blockPassthroughParser. Blocks that start mid-paragraph are
+// emitted by an ASTTransformer that splits a paragraph at the point of an
+// inline passthrough with the matching block delimiters.
 type PassthroughBlock struct {
 	ast.BaseBlock
 	// The matched delimiters
 	Delimiters *Delimiters
+
+	// The name of the LaTeX environment, e.g. "align", if this block is an
+	// environment passthrough. The delimiters are then \begin{name} and
+	// \end{name}.
+	Environment string
+
+	// The equation number assigned to this block when EquationNumbering is
+	// enabled and the block has an id attribute, or 0.
+	Number int
+
+	// The info string, e.g. "math", of the fenced code block that this block
+	// was parsed from, or an empty string. The lines of such a block hold
+	// its content only, as its delimiters are not in the source.
+	Fence string
+
+	// The fenced code block, including its fences, if Fence is set.
+	fenceSegment text.Segment
+
+	// Start is the position of the opening delimiter and End the position
+	// just after the closing delimiter, or the fences of a fenced code
+	// block. They are set once the document is parsed.
+	Start Position
+	End   Position
+}
+
+// IsRaw implements Node.IsRaw. The content of a passthrough block is never
+// parsed as inline Markdown.
+func (n *PassthroughBlock) IsRaw() bool {
+	return true
+}
+
+// Value returns the text of the passthrough, including its delimiters.
+func (n *PassthroughBlock) Value(source []byte) []byte {
+	if n.Fence == "" {
+		return n.Lines().Value(source)
+	}
+	b := []byte(n.Delimiters.Open + "\n")
+	b = append(b, n.Lines().Value(source)...)
+	return append(b, n.Delimiters.Close...)
+}
+
+// Name returns the name of the matched delimiters, or an empty string if
+// they have none.
+func (n *PassthroughBlock) Name() string {
+	if n.Delimiters == nil {
+		return ""
+	}
+	return n.Delimiters.Name
 }
 
 // Dump implements Node.Dump.
 func (n *PassthroughBlock) Dump(source []byte, level int) {
-	ast.DumpHelper(n, source, level, nil, nil)
+	kv := map[string]string{}
+	if name := n.Name(); name != "" {
+		kv["Name"] = name
+	}
+	if n.Environment != "" {
+		kv["Environment"] = n.Environment
+	}
+	if n.Fence != "" {
+		kv["Fence"] = n.Fence
+	}
+	if n.Number != 0 {
+		kv["Number"] = strconv.Itoa(n.Number)
+	}
+	if n.Start.IsValid() {
+		kv["Start"] = n.Start.String()
+		kv["End"] = n.End.String()
+	}
+	ast.DumpHelper(n, source, level, kv, nil)
 }
 
 // KindPassthroughBlock is a NodeKind of the PassthroughBlock node.
@@ -299,28 +790,486 @@ func newPassthroughBlock(delimiters *Delimiters) *PassthroughBlock {
 	}
 }
 
-type passthroughBlockRenderer struct{}
+// passthroughScanner tracks whether text, fed to it line by line, has an
+// opening delimiter without a matching closing delimiter after it. It follows
+// the same scanning rules as inlinePassthroughParser.Parse.
+type passthroughScanner struct {
+	delims []Delimiters
+
+	// The delimiters of the unclosed passthrough, or nil, and the number of
+	// its nested openers that are still open.
+	open  *Delimiters
+	depth int
+}
+
+// scan advances the scanner over b.
+func (s *passthroughScanner) scan(b []byte) {
+	i := 0
+	if s.open != nil {
+		closingDelimiterPos, depth := s.open.closingDelimiterIndex(b, s.depth)
+		if closingDelimiterPos == -1 {
+			s.depth = depth
+			return
+		}
+		i = closingDelimiterPos + len(s.open.Close)
+		s.open, s.depth = nil, 0
+	}
+	for ; i < len(b); i++ {
+		if b[i] == '\\' && i+1 < len(b) && b[i+1] == '\\' {
+			if d := getFullOpeningDelimiter(s.delims, b[i+2:]); d != nil {
+				i += 1 + len(d.Open)
+				continue
+			}
+		}
+		d := getFullOpeningDelimiter(s.delims, b[i:])
+		if d == nil {
+			continue
+		}
+		closingDelimiterPos, depth := d.closingDelimiterIndex(b[i+len(d.Open):], 0)
+		if closingDelimiterPos == -1 {
+			s.open, s.depth = d, depth
+			return
+		}
+		if closingDelimiterPos > 0 {
+			i += len(d.Open) + closingDelimiterPos + len(d.Close) - 1
+		}
+	}
+}
+
+var paragraphScanKey = parser.NewContextKey()
+
+// paragraphScan is the state of the scan of the open paragraph, kept in the
+// parser.Context so that each of its lines is scanned only once.
+type paragraphScan struct {
+	node  ast.Node
+	lines int
+	passthroughScanner
+}
+
+// paragraphHasUnclosedPassthrough reports whether the last opened block is a
+// paragraph with an unclosed passthrough. A block parser must not interrupt
+// such a paragraph, as the current line belongs to the passthrough.
+func paragraphHasUnclosedPassthrough(delims []Delimiters, source []byte, pc parser.Context) bool {
+	last := pc.LastOpenedBlock().Node
+	if last == nil || !ast.IsParagraph(last) {
+		return false
+	}
+	scan, ok := pc.Get(paragraphScanKey).(*paragraphScan)
+	if !ok || scan.node != last || scan.lines > last.Lines().Len() {
+		scan = &paragraphScan{node: last, passthroughScanner: passthroughScanner{delims: delims}}
+		pc.Set(paragraphScanKey, scan)
+	}
+	lines := last.Lines()
+	for ; scan.lines < lines.Len(); scan.lines++ {
+		line := lines.At(scan.lines)
+		scan.scan(line.Value(source))
+	}
+	return scan.open != nil
+}
+
+var passthroughBlockInfoKey = parser.NewContextKey()
+
+type passthroughBlockData struct {
+	node   ast.Node
+	closed bool
+
+	// The number of nested openers that are still open.
+	depth int
+}
+
+// closeBlockData reports a diagnostic if the passthrough block node was closed
+// before its closing delimiter, e.g. at the end of its blockquote. delims are
+// the delimiters of the inline parser.
+func closeBlockData(node ast.Node, data *passthroughBlockData, delims []Delimiters, source []byte, pc parser.Context) {
+	if data.closed {
+		return
+	}
+	lines := node.Lines()
+	d := node.(*PassthroughBlock).Delimiters
+	kind := unclosedKind(delims, source, d, lines.At(lines.Len()-1).Stop, data.depth)
+	addDiagnostic(pc, source, kind, d, lines.At(0).Start)
+}
+
+// blockPassthroughParser parses passthrough blocks whose opening delimiter is
+// the first non-space text on a line. Unlike paragraphs, these blocks may
+// contain blank lines and may interrupt a paragraph.
+type blockPassthroughParser struct {
+	BlockDelimiters []Delimiters
+
+	// All delimiters handled by the inline parser, used to decide whether a
+	// paragraph can be interrupted.
+	InlineDelimiters []Delimiters
+
+	// Whether an attribute list may follow the closing delimiter.
+	Attributes bool
+}
+
+func newBlockPassthroughParser(blockDelims, inlineDelims []Delimiters, attributes bool) parser.BlockParser {
+	return &blockPassthroughParser{
+		BlockDelimiters:  blockDelims,
+		InlineDelimiters: inlineDelims,
+		Attributes:       attributes,
+	}
+}
+
+// Trigger implements parser.BlockParser.
+func (b *blockPassthroughParser) Trigger() []byte {
+	return openersFirstByte(b.BlockDelimiters)
+}
+
+// Open implements parser.BlockParser.
+func (b *blockPassthroughParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+
+	fencePair := getFullOpeningDelimiter(b.BlockDelimiters, line[pos:])
+	if fencePair == nil {
+		return nil, parser.NoChildren
+	}
+
+	// If the paragraph we would interrupt has an unclosed opener, this line
+	// holds its closing delimiter, so leave it to the inline parser.
+	if paragraphHasUnclosedPassthrough(b.InlineDelimiters, reader.Source(), pc) {
+		return nil, parser.NoChildren
+	}
+
+	// The opener can't be inside the padding, so pos maps straight to source.
+	start := segment.Start - segment.Padding + pos
+	openerStop := start + len(fencePair.Open)
+	rest := line[pos+len(fencePair.Open):]
+	closingDelimiterPos, depth := fencePair.closingDelimiterIndex(rest, 0)
+
+	node := newPassthroughBlock(fencePair)
+	data := &passthroughBlockData{node: node, depth: depth}
+	switch {
+	case closingDelimiterPos == 0:
+		// Empty passthroughs are left as text, as in the inline parser.
+		return nil, parser.NoChildren
+	case closingDelimiterPos > 0:
+		// Text after the closer, other than an attribute list, means the
+		// block is part of a paragraph, which is handled by the inline parser
+		// and passthroughInlineTransformer.
+		if after := rest[closingDelimiterPos+len(fencePair.Close):]; !util.IsBlank(after) {
+			attrs, ok := parseTrailingAttributes(after)
+			if !ok || !b.Attributes {
+				return nil, parser.NoChildren
+			}
+			setAttributes(node, attrs, pc)
+		} else if nextLineExtendsParagraph(reader.Source(), segment) {
+			// Leave it to the paragraph, which the next line turns into a
+			// setext heading or a definition term.
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, openerStop+closingDelimiterPos+len(fencePair.Close)))
+		data.closed = true
+	default:
+		// Without a closer later in its container, the opener is left to the
+		// inline parser.
+		found, _ := findContainerCloser(pc, reader.Source(), segment.Stop, parent, fencePair, depth, fencePair.closerBalance)
+		if !found {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, segment.Stop))
+	}
+
+	reader.AdvanceToEOL()
+	pc.Set(passthroughBlockInfoKey, data)
+	return node, parser.NoChildren
+}
+
+// closerBalance describes how a line affects a scan for a closing delimiter
+// with nesting: the scan finds a closing delimiter in the line if it starts
+// the line with a depth of at most threshold, and ok is false if it finds none
+// at any depth. Otherwise the depth changes by net over the line.
+type closerBalance func(line []byte) (threshold, net int, ok bool)
+
+// closerBalance implements closerBalance for closingDelimiterIndex.
+func (d *Delimiters) closerBalance(b []byte) (threshold, net int, ok bool) {
+	if !d.Nested || d.Open == d.Close {
+		i, _ := d.closingDelimiterIndex(b, 0)
+		return 0, 0, i >= 0
+	}
+	for i := 0; i < len(b); i++ {
+		switch {
+		case startsWith(b[i:], d.Close) && !isEscaped(b, i) && d.Constraints.canClose(b, i, len(d.Close)):
+			// The scan returns if the depth is zero here.
+			if !ok || -net > threshold {
+				threshold, ok = -net, true
+			}
+			net--
+			i += len(d.Close) - 1
+		case startsWith(b[i:], d.Open) && !isEscaped(b, i):
+			net++
+			i += len(d.Open) - 1
+		}
+	}
+	return threshold, net, ok
+}
+
+// containerScan records how the lines of a container, from the line at which
+// it was built to the end of the container, balance the closing delimiters of
+// one kind, so that each line is scanned once however many openers look for
+// a closer in it.
+type containerScan struct {
+	// The offsets of the starts of the lines, and of the end of the last.
+	starts []int
+	end    int
+
+	// depths[i] is the change in depth before line i, and reach[i] the
+	// highest threshold minus depth of the lines from i on.
+	depths []int
+	reach  []int
+}
+
+func newContainerScan(source []byte, start int, parent ast.Node, balance closerBalance) *containerScan {
+	var containers []ast.Node
+	for n := parent; n != nil; n = n.Parent() {
+		containers = append(containers, n)
+	}
+	slices.Reverse(containers)
+
+	s := &containerScan{}
+	depth := 0
+	pos := start
+	for pos < len(source) {
+		stop := len(source)
+		if i := bytes.IndexByte(source[pos:], '\n'); i >= 0 {
+			stop = pos + i + 1
+		}
+		line, ok := stripContainerPrefixes(source[pos:stop], containers)
+		if !ok {
+			break
+		}
+		reach := math.MinInt
+		threshold, net, ok := balance(line)
+		if ok {
+			reach = threshold - depth
+		}
+		s.starts = append(s.starts, pos)
+		s.depths = append(s.depths, depth)
+		s.reach = append(s.reach, reach)
+		depth += net
+		pos = stop
+	}
+	s.end = pos
+	for i := len(s.reach) - 2; i >= 0; i-- {
+		s.reach[i] = max(s.reach[i], s.reach[i+1])
+	}
+	return s
+}
+
+// find reports whether a scan that starts at the line at offset start with
+// the given depth finds a closing delimiter, and ok false if the line is not
+// one of the lines of s.
+func (s *containerScan) find(start, depth int) (found, ok bool) {
+	if start == s.end {
+		return false, true
+	}
+	i, ok := slices.BinarySearch(s.starts, start)
+	if !ok {
+		return false, false
+	}
+	return s.reach[i] >= depth-s.depths[i], true
+}
+
+type containerScanKey struct {
+	parent ast.Node
+	delims Delimiters
+}
+
+var containerScansKey = parser.NewContextKey()
+
+// findContainerCloser reports whether the lines of source from offset start
+// that continue the containers of parent, without their prefixes, have a
+// closing delimiter of d for a scan that starts with the given depth. It also
+// returns the offset of the end of those lines. Blockquotes and list items
+// are followed; other containers are assumed to continue. The scans are kept
+// in pc, so that finding the closers of many openers takes linear time.
+func findContainerCloser(pc parser.Context, source []byte, start int, parent ast.Node, d *Delimiters, depth int, balance closerBalance) (bool, int) {
+	scans, _ := pc.Get(containerScansKey).(map[containerScanKey]*containerScan)
+	if scans == nil {
+		scans = make(map[containerScanKey]*containerScan)
+		pc.Set(containerScansKey, scans)
+	}
+	key := containerScanKey{parent: parent, delims: *d}
+	if s, ok := scans[key]; ok {
+		if found, ok := s.find(start, depth); ok {
+			return found, s.end
+		}
+	}
+	s := newContainerScan(source, start, parent, balance)
+	scans[key] = s
+	found, _ := s.find(start, depth)
+	return found, s.end
+}
+
+// stripContainerPrefixes returns line without the prefixes of containers,
+// outermost first, and whether line continues all of them.
+func stripContainerPrefixes(line []byte, containers []ast.Node) ([]byte, bool) {
+	for _, c := range containers {
+		switch c := c.(type) {
+		case *ast.Blockquote:
+			i := 0
+			for i < len(line) && i < 3 && line[i] == ' ' {
+				i++
+			}
+			if i == len(line) || line[i] != '>' {
+				return nil, false
+			}
+			i++
+			if i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+				i++
+			}
+			line = line[i:]
+		case *ast.ListItem:
+			if util.IsBlank(line) {
+				return line, true
+			}
+			if w, _ := util.IndentWidth(line, 0); w < c.Offset {
+				return nil, false
+			}
+			i, _ := util.IndentPosition(line, 0, c.Offset)
+			line = line[i:]
+		}
+	}
+	return line, true
+}
+
+// nextLineExtendsParagraph reports whether the line after the one of
+// segment is a setext heading underline or starts a definition, either of
+// which would turn a paragraph made of the line of segment into a heading or
+// a definition term. Container prefixes such as "> " are skipped up to the
+// width of the prefix of the line of segment.
+func nextLineExtendsParagraph(source []byte, segment text.Segment) bool {
+	lineStart := bytes.LastIndexByte(source[:segment.Start], '\n') + 1
+	prefix := segment.Start - segment.Padding - lineStart
+	next := source[segment.Stop:]
+	if i := bytes.IndexByte(next, '\n'); i >= 0 {
+		next = next[:i]
+	}
+	for i := 0; i < prefix && len(next) > 0 && (next[0] == '>' || util.IsSpace(next[0])); i++ {
+		next = next[1:]
+	}
+	if w, _ := util.IndentWidth(next, 0); w > 3 {
+		return false
+	}
+	next = util.TrimRightSpace(util.TrimLeftSpace(next))
+	if len(next) == 0 {
+		return false
+	}
+	if next[0] == ':' {
+		return len(next) == 1 || util.IsSpace(next[1])
+	}
+	if next[0] != '=' && next[0] != '-' {
+		return false
+	}
+	for _, c := range next {
+		if c != next[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// Continue implements parser.BlockParser.
+func (b *blockPassthroughParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	data := pc.Get(passthroughBlockInfoKey).(*passthroughBlockData)
+	if data.closed {
+		return parser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+
+	fencePair := node.(*PassthroughBlock).Delimiters
+	closingDelimiterPos, depth := fencePair.closingDelimiterIndex(line, data.depth)
+	data.depth = depth
+	if closingDelimiterPos == -1 {
+		node.Lines().Append(segment)
+		reader.AdvanceToEOL()
+		return parser.Continue | parser.NoChildren
+	}
+
+	// Anything after the closer, other than an attribute list, is parsed as
+	// a new block.
+	stop := segment.Start - segment.Padding + closingDelimiterPos + len(fencePair.Close)
+	node.Lines().Append(segment.WithStop(stop))
+	if attrs, ok := parseTrailingAttributes(line[closingDelimiterPos+len(fencePair.Close):]); ok && b.Attributes {
+		setAttributes(node, attrs, pc)
+		reader.AdvanceToEOL()
+	} else {
+		reader.Advance(closingDelimiterPos + len(fencePair.Close))
+	}
+	data.closed = true
+	return parser.Close
+}
+
+// Close implements parser.BlockParser.
+func (b *blockPassthroughParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	data, ok := pc.Get(passthroughBlockInfoKey).(*passthroughBlockData)
+	if ok && data.node == node {
+		closeBlockData(node, data, b.InlineDelimiters, reader.Source(), pc)
+		pc.Set(passthroughBlockInfoKey, nil)
+	}
+}
+
+// CanInterruptParagraph implements parser.BlockParser.
+func (b *blockPassthroughParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser.
+func (b *blockPassthroughParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type passthroughBlockRenderer struct {
+	html.Config
+	renderer Renderer
+}
 
 func (r *passthroughBlockRenderer) renderRawBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
 	if entering {
-		l := n.Lines().Len()
-		for i := 0; i < l; i++ {
-			line := n.Lines().At(i)
-			w.WriteString(string(line.Value(source)))
+		n, ok := n.(*PassthroughBlock)
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		value := n.Value(source)
+		if r.renderer != nil {
+			err := r.renderer.RenderBlock(w, RenderContext{
+				Node:       n,
+				Source:     source,
+				Content:    trimDelimiters(value, n.Delimiters),
+				Delimiters: n.Delimiters,
+				Display:    true,
+			})
+			if !errors.Is(err, ErrUseDefault) {
+				return ast.WalkSkipChildren, err
+			}
 		}
+		renderDefault(w, value, n.Delimiters, n, r.Config, "div")
 		w.WriteString("\n")
 	}
 	return ast.WalkSkipChildren, nil
 }
 
-// To support the use of passthrough block delimiters in inline contexts, I
-// wasn't able to get the normal block parser to work. Goldmark seems to only
-// trigger the inline parser when the trigger is not the first characters in a
-// block. So instead we hook into the transformer interface, and process an
-// inline passthrough after it's parsed, looking for nodes whose delimiters
-// match the block delimiters, and splitting the paragraph at that point.
+// Block delimiters that start a line are handled by blockPassthroughParser,
+// but block delimiters can also appear in the middle of a paragraph, where
+// only the inline parser sees them. So we also hook into the transformer
+// interface, and process an inline passthrough after it's parsed, looking for
+// nodes whose delimiters match the block delimiters, and splitting the
+// paragraph at that point.
 type passthroughInlineTransformer struct {
 	BlockDelimiters []Delimiters
+
+	// Whether an attribute list may follow the closing delimiter of a
+	// block passthrough.
+	Attributes bool
 }
 
 var PassthroughInlineTransformer = &passthroughInlineTransformer{}
@@ -394,7 +1343,22 @@ func (p *passthroughInlineTransformer) Transform(
 
 				newBlock := newPassthroughBlock(inline.Delimiters)
 				newBlock.SetPos(inline.Pos())
-				newBlock.Lines().Append(inline.Segment)
+				if inline.LineSegments != nil {
+					newBlock.Lines().AppendAll(inline.LineSegments)
+				} else {
+					newBlock.Lines().Append(inline.Segment)
+				}
+				// An attribute list may directly follow the closing delimiter.
+				if t, ok := nextNode.(*ast.Text); ok && p.Attributes {
+					if attrs, length, ok := parseLeadingAttributes(t.Segment.Value(source)); ok {
+						setAttributes(newBlock, attrs, pc)
+						if length == t.Segment.Len() {
+							nextNode = t.NextSibling()
+						} else {
+							t.Segment = t.Segment.WithStart(t.Segment.Start + length)
+						}
+					}
+				}
 				if currentContainer.ChildCount() > 0 {
 					// Trim trailing whitespace from text preceding the block in tight lists
 					if containerKind == ast.KindTextBlock {
@@ -457,9 +1421,10 @@ func (p *passthroughInlineTransformer) Transform(
 	})
 }
 
-func newPassthroughInlineTransformer(ds []Delimiters) parser.ASTTransformer {
+func newPassthroughInlineTransformer(ds []Delimiters, attributes bool) parser.ASTTransformer {
 	return &passthroughInlineTransformer{
 		BlockDelimiters: ds,
+		Attributes:      attributes,
 	}
 }
 
@@ -476,45 +1441,191 @@ func (r *passthroughBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRe
 // ---- Extension and config ----
 
 type passthrough struct {
-	InlineDelimiters []Delimiters
-	BlockDelimiters  []Delimiters
+	InlineDelimiters      []Delimiters
+	BlockDelimiters       []Delimiters
+	Environments          []string
+	EnvironmentDelimiters Delimiters
+	FencedCodeBlocks      []string
+	EquationNumbering     bool
+	Attributes            bool
+	Table                 goldmark.Extender
+	Renderer              Renderer
+
+	// The template of the dollar-backtick delimiters, or nil if disabled.
+	dollarBacktick *Delimiters
 }
 
 // Config configures this extension.
 type Config struct {
 	InlineDelimiters []Delimiters
 	BlockDelimiters  []Delimiters
+
+	// Environments lists the names of LaTeX environments, e.g. "align" or
+	// "align*", that are passed through as blocks when written as
+	// \begin{name} ... \end{name} at the start of a line, without other
+	// delimiters.
+	Environments []string
+
+	// EnvironmentDelimiters sets the Name and Output of the delimiters of
+	// environment blocks; its Open and Close are ignored. If it is the zero
+	// value, the Name and Output of the first block delimiters are used,
+	// without StripDelimiters.
+	EnvironmentDelimiters Delimiters
+
+	// FencedCodeBlocks lists the languages, e.g. "math" or "latex", of the
+	// fenced code blocks that are passed through as blocks, as GitHub and
+	// GitLab do for ```math. Their delimiters are those of the first block
+	// delimiters, or $$ if there are none. An attribute list may follow the
+	// language, e.g. ```math {#eq:energy}.
+	FencedCodeBlocks []string
+
+	// EquationNumbering numbers the passthrough blocks that have an id
+	// attribute, e.g. $$ E=mc^2 $$ {#eq:energy}, in document order, and
+	// enables references to them written as [@eq:energy] or
+	// \eqref{eq:energy}, which are rendered as links with the block's
+	// number. It implies Attributes.
+	EquationNumbering bool
+
+	// Attributes enables attribute lists after the closing delimiter of
+	// block passthroughs, e.g. $$ E=mc^2 $$ {#eq:energy .numbered}, and
+	// after the language of fenced code blocks, e.g. ```math {#eq:energy}.
+	Attributes bool
+
+	// Table, if set, is the GFM table extension to use, e.g. extension.Table
+	// or extension.NewTable with options. This extension adds it to the
+	// Markdown, and keeps passthroughs whole within its table cells, so that
+	// the pipes in e.g. $|x|$ do not split cells.
+	Table goldmark.Extender
+
+	// DollarBacktick enables GitLab's inline math, written as $`a^2`$, with
+	// backtick runs of the same length on both sides, as for code spans. The
+	// nodes get the name and output of the first inline delimiters, and
+	// $`...`$ as their delimiters.
+	DollarBacktick bool
+
+	// Renderer, if set, renders the content of passthrough nodes instead of
+	// writing it as is.
+	Renderer Renderer
 }
 
 func New(c Config) goldmark.Extender {
-	// The parser executes in two phases:
+	// The parser executes in three phases:
 	//
-	// Phase 1: parse the input with all delimiters treated as inline, and block delimiters
-	// taking precedence over inline delimiters.
+	// Phase 1: parse blocks whose opening delimiter starts a line with the
+	// block parser.
 	//
-	// Phase 2: transform the parsed AST to split paragraphs at the point of
+	// Phase 2: parse the remaining input with all delimiters treated as inline,
+	// and block delimiters taking precedence over inline delimiters.
+	//
+	// Phase 3: transform the parsed AST to split paragraphs at the point of
 	// inline passthroughs with matching block delimiters.
 	combinedDelimiters := make([]Delimiters, len(c.InlineDelimiters)+len(c.BlockDelimiters))
 	copy(combinedDelimiters, c.BlockDelimiters)
 	copy(combinedDelimiters[len(c.BlockDelimiters):], c.InlineDelimiters)
+	var dollarBacktick *Delimiters
+	if c.DollarBacktick {
+		dollarBacktick = &Delimiters{}
+		if len(c.InlineDelimiters) > 0 {
+			dollarBacktick.Name = c.InlineDelimiters[0].Name
+			dollarBacktick.Output = c.InlineDelimiters[0].Output
+		}
+	}
 	return &passthrough{
-		InlineDelimiters: combinedDelimiters,
-		BlockDelimiters:  c.BlockDelimiters,
+		InlineDelimiters:      combinedDelimiters,
+		BlockDelimiters:       c.BlockDelimiters,
+		Environments:          c.Environments,
+		EnvironmentDelimiters: environmentTemplate(c.EnvironmentDelimiters, c.BlockDelimiters),
+		FencedCodeBlocks:      c.FencedCodeBlocks,
+		EquationNumbering:     c.EquationNumbering,
+		Attributes:            c.Attributes || c.EquationNumbering,
+		Table:                 c.Table,
+		Renderer:              c.Renderer,
+		dollarBacktick:        dollarBacktick,
 	}
 }
 
 func (e *passthrough) Extend(m goldmark.Markdown) {
+	if len(e.BlockDelimiters) > 0 {
+		m.Parser().AddOptions(
+			parser.WithBlockParsers(
+				util.Prioritized(newBlockPassthroughParser(e.BlockDelimiters, e.InlineDelimiters, e.Attributes), 750),
+			),
+		)
+	}
+	if len(e.Environments) > 0 {
+		m.Parser().AddOptions(
+			parser.WithBlockParsers(
+				util.Prioritized(newEnvironmentPassthroughParser(e.Environments, e.InlineDelimiters, e.EnvironmentDelimiters, e.Attributes), 751),
+			),
+		)
+	}
+	if len(e.FencedCodeBlocks) > 0 {
+		m.Parser().AddOptions(
+			parser.WithBlockParsers(
+				// Before goldmark's fenced code block parser at 700.
+				util.Prioritized(newFencedCodeBlockParser(e.FencedCodeBlocks, e.BlockDelimiters, e.Attributes), 699),
+			),
+		)
+	}
+	if e.Attributes && len(e.BlockDelimiters) > 0 {
+		m.Parser().AddOptions(
+			parser.WithParagraphTransformers(
+				// After the table transformers, which may take the paragraph.
+				util.Prioritized(newAttributeIDTransformer(e.InlineDelimiters, e.BlockDelimiters), 300),
+			),
+		)
+	}
+	if e.EquationNumbering {
+		m.Parser().AddOptions(
+			parser.WithInlineParsers(
+				util.Prioritized(newEquationReferenceParser(), 199),
+			),
+			parser.WithASTTransformers(
+				util.Prioritized(&equationNumberingTransformer{}, 100),
+			),
+		)
+		m.Renderer().AddOptions(renderer.WithNodeRenderers(
+			util.Prioritized(&equationReferenceRenderer{}, 100),
+		))
+	}
+	if e.dollarBacktick != nil {
+		m.Parser().AddOptions(
+			parser.WithInlineParsers(
+				// Before the inline passthrough parser, which would take $`
+				// for a $ delimiter.
+				util.Prioritized(newDollarBacktickParser(*e.dollarBacktick), 200),
+			),
+		)
+	}
+	if e.Table != nil {
+		e.Table.Extend(m)
+		m.Parser().AddOptions(
+			parser.WithParagraphTransformers(
+				// Before the table extension's transformer at 200.
+				util.Prioritized(newTableParagraphTransformer(e.InlineDelimiters), 199),
+			),
+		)
+	}
 	m.Parser().AddOptions(
 		parser.WithInlineParsers(
 			util.Prioritized(newInlinePassthroughParser(e.InlineDelimiters), 201),
 		),
 		parser.WithASTTransformers(
-			util.Prioritized(newPassthroughInlineTransformer(e.BlockDelimiters), 0),
+			util.Prioritized(newPassthroughInlineTransformer(e.BlockDelimiters, e.Attributes), 0),
+			util.Prioritized(&positionTransformer{}, 999),
+			util.Prioritized(&inventoryTransformer{}, 1000),
 		),
 	)
 
 	m.Renderer().AddOptions(renderer.WithNodeRenderers(
-		util.Prioritized(&passthroughInlineRenderer{}, 101),
-		util.Prioritized(&passthroughBlockRenderer{}, 99),
+		util.Prioritized(&passthroughInlineRenderer{
+			Config:          html.NewConfig(),
+			renderer:        e.Renderer,
+			blockDelimiters: e.BlockDelimiters,
+		}, 101),
+		util.Prioritized(&passthroughBlockRenderer{
+			Config:   html.NewConfig(),
+			renderer: e.Renderer,
+		}, 99),
 	))
 }
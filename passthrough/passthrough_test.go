@@ -2,13 +2,20 @@ package passthrough
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 
 	qt "github.com/frankban/quicktest"
 )
@@ -576,19 +583,295 @@ func TestIssue32(t *testing.T) {
 $$ a^n + b^n = c^n $$
 line two`
 
-	// The mid-paragraph new lines are undesirable, but this is how it worked
-	// with Goldmark v1.7.4.
-	expected := `<p>line one
-</p>
+	expected := `<p>line one</p>
 $$ a^n + b^n = c^n $$
-<p>
-line two</p>`
+<p>line two</p>`
 	actual := Parse(t, input)
 
 	c := qt.New(t)
 	c.Assert(actual, qt.Equals, expected)
 }
 
+func TestBlockInterruptsParagraph(t *testing.T) {
+	input := `An equation:
+$$
+a^*=x-b^*
+$$
+Amazing`
+	expected := `<p>An equation:</p>
+$$
+a^*=x-b^*
+$$
+<p>Amazing</p>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestBlockWithBlankLines(t *testing.T) {
+	input := `$$
+\begin{aligned}
+a^*&=x-b^*
+
+c^*&=y-d^*
+\end{aligned}
+$$
+
+Amazing`
+	expected := `$$
+\begin{aligned}
+a^*&=x-b^*
+
+c^*&=y-d^*
+\end{aligned}
+$$
+<p>Amazing</p>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestBlockWithTextAfterCloser(t *testing.T) {
+	input := `$$
+a^*=x-b^*
+$$ equation`
+	expected := `$$
+a^*=x-b^*
+$$
+<p>equation</p>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestBlockOpenerClosesInlinePassthrough(t *testing.T) {
+	// The $$ at the start of the third line closes the passthrough opened on
+	// the first line, so it must not start a new block.
+	input := `Block $$
+a^*=x-b^*
+$$ equation
+
+$$b$$`
+	expected := `<p>Block </p>
+$$
+a^*=x-b^*
+$$
+<p> equation</p>
+$$b$$`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestUnterminatedBlockDelimiters(t *testing.T) {
+	input := `$$
+a^*=x-b^*`
+	expected := `<p>$$
+a^<em>=x-b^</em></p>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestBlockCloserOutsideContainer(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"list item",
+			"* $$\nx\n* y\n$$",
+			`<ul>
+<li>$$
+x</li>
+<li>y
+$$</li>
+</ul>`,
+		},
+		{
+			"blockquote",
+			"> $$\n> a\n\n$$",
+			`<blockquote>
+<p>$$
+a</p>
+</blockquote>
+<p>$$</p>`,
+		},
+		{
+			"closer inside list item in blockquote",
+			"> - $$\n>   a\n>\n>   $$",
+			`<blockquote>
+<ul>
+<li>
+$$
+a
+
+$$
+</li>
+</ul>
+</blockquote>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := qt.New(t)
+			c.Assert(Parse(t, test.input), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestBlockLines(t *testing.T) {
+	input := `Intro
+$$
+a^*=x-b^*
+$$`
+
+	c := qt.New(t)
+
+	md := buildTestParser()
+	doc := md.Parser().Parse(text.NewReader([]byte(input)))
+	c.Assert(doc.ChildCount(), qt.Equals, 2)
+	c.Assert(string(doc.FirstChild().Lines().Value([]byte(input))), qt.Equals, "Intro")
+	block, ok := doc.LastChild().(*PassthroughBlock)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(block.Lines().Len(), qt.Equals, 3)
+	c.Assert(string(block.Lines().Value([]byte(input))), qt.Equals, "$$\na^*=x-b^*\n$$")
+}
+
+func TestInlineMathAcrossLinesInBlockquote(t *testing.T) {
+	input := `> Inline $a^*=
+> x-b^*$ equation`
+	expected := `<blockquote>
+<p>Inline $a^*=
+x-b^*$ equation</p>
+</blockquote>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestBlockMathInBlockquote(t *testing.T) {
+	input := `> $$
+> a^*=x-b^*
+> $$`
+	expected := `<blockquote>
+$$
+a^*=x-b^*
+$$
+</blockquote>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestMathAcrossLinesInList(t *testing.T) {
+	input := `- inline $a^*=
+  x-b^*$
+- $$
+  a^*=x-b^*
+  $$`
+	expected := `<ul>
+<li>inline $a^*=
+x-b^*$</li>
+<li>
+$$
+a^*=x-b^*
+$$
+</li>
+</ul>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestMathAcrossLinesInListInBlockquote(t *testing.T) {
+	input := `> - $$
+>   a^*=
+>   x-b^*
+>   $$
+> - $a^*=
+>   x-b^*$`
+	expected := `<blockquote>
+<ul>
+<li>
+$$
+a^*=
+x-b^*
+$$
+</li>
+<li>$a^*=
+x-b^*$</li>
+</ul>
+</blockquote>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestMathAcrossLinesInBlockquoteInList(t *testing.T) {
+	input := `- > $$
+  > a^*=x-b^*
+  > $$
+  > and $a^*=
+  > x-b^*$`
+	expected := `<ul>
+<li>
+<blockquote>
+$$
+a^*=x-b^*
+$$
+<p>and $a^*=
+x-b^*$</p>
+</blockquote>
+</li>
+</ul>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestLineSegments(t *testing.T) {
+	input := `> - $$
+>   a^*=
+>   $$`
+
+	c := qt.New(t)
+
+	var block *PassthroughBlock
+	ParseWalk(t, input, func(n ast.Node, entering bool) bool {
+		if n, ok := n.(*PassthroughBlock); ok && entering {
+			block = n
+		}
+		return false
+	})
+	c.Assert(block, qt.IsNotNil)
+	c.Assert(block.Lines().Len(), qt.Equals, 3)
+	c.Assert(string(block.Lines().Value([]byte(input))), qt.Equals, "$$\na^*=\n$$")
+
+	var inline *PassthroughInline
+	input = "> a $b\n> c$"
+	ParseWalk(t, input, func(n ast.Node, entering bool) bool {
+		if n, ok := n.(*PassthroughInline); ok && entering {
+			inline = n
+		}
+		return false
+	})
+	c.Assert(inline, qt.IsNotNil)
+	c.Assert(inline.LineSegments, qt.HasLen, 2)
+	c.Assert(string(inline.Value([]byte(input))), qt.Equals, "$b\nc$")
+	c.Assert(string(inline.Segment.Value([]byte(input))), qt.Equals, "$b\n> c$")
+}
+
 func TestNodeDelimiter(t *testing.T) {
 	input := `
 Block $$a^*=x-b^*$$ equation
@@ -613,6 +896,41 @@ Inline $a^*=x-b^*$ equation
 	})
 }
 
+func TestNodeName(t *testing.T) {
+	input := `Math $a^*$ and chemistry \ce{H2O}
+
+\[a^*=x-b^*\]`
+
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{
+						{Open: "$", Close: "$", Name: "math"},
+						{Open: "\\ce{", Close: "}", Name: "chem"},
+					},
+					BlockDelimiters: []Delimiters{{Open: "\\[", Close: "\\]"}},
+				},
+			)),
+	)
+	doc := md.Parser().Parse(text.NewReader([]byte(input)))
+	var names []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch nn := n.(type) {
+		case *PassthroughInline:
+			names = append(names, nn.Name())
+		case *PassthroughBlock:
+			names = append(names, nn.Name())
+		}
+		return ast.WalkContinue, nil
+	})
+	c.Assert(names, qt.DeepEquals, []string{"math", "chem", ""})
+}
+
 func TestBlockMathInTightUnorderedList(t *testing.T) {
 	input := `- $$a^*=x-b^*$$
 - item 2`
@@ -1107,6 +1425,40 @@ func TestBlockMathInDescriptionListTerm(t *testing.T) {
 	c.Assert(actual, qt.Equals, expected)
 }
 
+func TestBlockMathAsSetextHeading(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"level 2",
+			"$$x$$\n---",
+			"<h2>$$x$$</h2>",
+		},
+		{
+			"level 1",
+			"$$x$$\n===",
+			"<h1>$$x$$</h1>",
+		},
+		{
+			"in blockquote",
+			"> $$x$$\n> ---",
+			"<blockquote>\n<h2>$$x$$</h2>\n</blockquote>",
+		},
+		{
+			"not an underline",
+			"$$x$$\n--- a",
+			"$$x$$\n<p>--- a</p>",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := qt.New(t)
+			c.Assert(Parse(t, test.input), qt.Equals, test.expected)
+		})
+	}
+}
+
 func TestInlineMathInDescriptionListTerm(t *testing.T) {
 	input := `$a^*=x-b^*$
 : definition`
@@ -1120,37 +1472,1400 @@ func TestInlineMathInDescriptionListTerm(t *testing.T) {
 	c.Assert(actual, qt.Equals, expected)
 }
 
-func BenchmarkWithAndWithoutPassthrough(b *testing.B) {
-	const input = `
-## Block
+func TestOutput(t *testing.T) {
+	input := `Inline $a^*$, \(b^*\) and \ce{H2O}
 
 $$
-a^*=x-b^*
+c^*
 $$
 
-## Inline
+\[d^*\]`
+	expected := `<p>Inline <span class="math inline">a^*</span>, <span>\(b^*\)</span> and \ce{H2O}</p>
+<div class="math display">
+c^*
+</div>
+\[d^*\]`
 
-Inline $a^*=x-b^*$ equation.`
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{
+						{Open: "$", Close: "$", Output: Output{Element: "span", Class: "math inline", StripDelimiters: true}},
+						{Open: "\\(", Close: "\\)", Output: Output{Element: "span"}},
+						{Open: "\\ce{", Close: "}", Output: Output{StripDelimiters: false}},
+					},
+					BlockDelimiters: []Delimiters{
+						{Open: "$$", Close: "$$", Output: Output{Element: "div", Class: "math display", StripDelimiters: true}},
+						{Open: "\\[", Close: "\\]"},
+					},
+				},
+			)),
+	)
+	var buf bytes.Buffer
+	c := qt.New(t)
+	c.Assert(md.Convert([]byte(input), &buf), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, expected)
+}
 
-	b.Run("without passthrough", func(b *testing.B) {
-		md := goldmark.New()
-		b.ResetTimer()
-		for i := 0; i < b.N; i++ {
+func TestEscape(t *testing.T) {
+	input := `Inline $a<b>c & d$ and \(x<y\)
+
+$$
+a<b
+$$`
+
+	build := func(opts ...renderer.Option) goldmark.Markdown {
+		return goldmark.New(
+			goldmark.WithRendererOptions(opts...),
+			goldmark.WithExtensions(
+				New(
+					Config{
+						InlineDelimiters: []Delimiters{
+							{Open: "$", Close: "$", Output: Output{Escape: EscapeHTML}},
+							{Open: "\\(", Close: "\\)", Output: Output{Escape: EscapeHTMLUnlessUnsafe}},
+						},
+						BlockDelimiters: []Delimiters{
+							{Open: "$$", Close: "$$", Output: Output{Element: "div", Escape: EscapeHTMLUnlessUnsafe}},
+						},
+					},
+				)),
+		)
+	}
+
+	c := qt.New(t)
+
+	var buf bytes.Buffer
+	c.Assert(build().Convert([]byte(input), &buf), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, `<p>Inline $a&lt;b&gt;c &amp; d$ and \(x&lt;y\)</p>
+<div>$$
+a&lt;b
+$$</div>`)
+
+	buf.Reset()
+	c.Assert(build(html.WithUnsafe()).Convert([]byte(input), &buf), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, `<p>Inline $a&lt;b&gt;c &amp; d$ and \(x<y\)</p>
+<div>$$
+a<b
+$$</div>`)
+}
+
+func buildEnvironmentTestParser() goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+					Environments:     []string{"align", "align*"},
+				},
+			)),
+	)
+}
+
+func TestEnvironmentDelimiters(t *testing.T) {
+	input := `\begin{align}
+a<b
+\end{align}`
+
+	for _, test := range []struct {
+		name         string
+		config       Config
+		expectedName string
+		expected     string
+	}{
+		{
+			"inherited from block delimiters",
+			Config{
+				BlockDelimiters: []Delimiters{{Open: "$$", Close: "$$", Name: "math", Output: Output{Element: "div", Class: "math", StripDelimiters: true, Escape: EscapeHTML}}},
+				Environments:    []string{"align"},
+			},
+			"math",
+			`<div class="math">\begin{align}
+a&lt;b
+\end{align}</div>`,
+		},
+		{
+			"explicit",
+			Config{
+				BlockDelimiters:       []Delimiters{{Open: "$$", Close: "$$", Name: "math", Output: Output{Escape: EscapeHTML}}},
+				Environments:          []string{"align"},
+				EnvironmentDelimiters: Delimiters{Name: "env", Output: Output{Element: "div", Class: "env"}},
+			},
+			"env",
+			`<div class="env">\begin{align}
+a<b
+\end{align}</div>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := qt.New(t)
+			md := goldmark.New(goldmark.WithExtensions(New(test.config)))
+			doc := md.Parser().Parse(text.NewReader([]byte(input)))
+			block, ok := doc.FirstChild().(*PassthroughBlock)
+			c.Assert(ok, qt.IsTrue)
+			c.Assert(block.Name(), qt.Equals, test.expectedName)
 			var buf bytes.Buffer
-			if err := md.Convert([]byte(input), &buf); err != nil {
-				b.Fatal(err)
-			}
-		}
-	})
+			c.Assert(md.Convert([]byte(input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
 
-	b.Run("with passthrough", func(b *testing.B) {
-		md := buildTestParser()
-		b.ResetTimer()
-		for i := 0; i < b.N; i++ {
+func TestEnvironment(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"basic",
+			`\begin{align}
+a^*&=x-b^*\\
+c_*&=y-d_*
+\end{align}`,
+			`\begin{align}
+a^*&=x-b^*\\
+c_*&=y-d_*
+\end{align}`,
+		},
+		{
+			"starred interrupts paragraph",
+			`An equation:
+\begin{align*}
+a^*=x-b^*
+
+c^*=y-d^*
+\end{align*}
+Amazing`,
+			`<p>An equation:</p>
+\begin{align*}
+a^*=x-b^*
+
+c^*=y-d^*
+\end{align*}
+<p>Amazing</p>`,
+		},
+		{
+			"nested",
+			`\begin{align}
+\begin{align}
+a^*
+\end{align}
+b^*
+\end{align}
+*c*`,
+			`\begin{align}
+\begin{align}
+a^*
+\end{align}
+b^*
+\end{align}
+<p><em>c</em></p>`,
+		},
+		{
+			"other environments inside",
+			`\begin{align}
+f(x) = \begin{cases} a^* \end{cases}
+\end{align}`,
+			`\begin{align}
+f(x) = \begin{cases} a^* \end{cases}
+\end{align}`,
+		},
+		{
+			"single line",
+			`\begin{align} a^*=x-b^* \end{align}`,
+			`\begin{align} a^*=x-b^* \end{align}`,
+		},
+		{
+			"not allowed",
+			`\begin{equation}
+a^*=x-b^*
+\end{equation}`,
+			`<p>\begin{equation}
+a^<em>=x-b^</em>
+\end{equation}</p>`,
+		},
+		{
+			"unclosed",
+			`\begin{align}
+a^*=x-b^*`,
+			`<p>\begin{align}
+a^<em>=x-b^</em></p>`,
+		},
+		{
+			"mismatched end",
+			`\begin{align}
+a^*=x-b^*
+\end{align*}`,
+			`<p>\begin{align}
+a^<em>=x-b^</em>
+\end{align*}</p>`,
+		},
+		{
+			"end outside list item",
+			`* \begin{align}
+x
+* y
+\end{align}`,
+			`<ul>
+<li>\begin{align}
+x</li>
+<li>y
+\end{align}</li>
+</ul>`,
+		},
+		{
+			"in blockquote",
+			`> \begin{align}
+> a^*
+>
+> \end{align}`,
+			`<blockquote>
+\begin{align}
+a^*
+
+\end{align}
+</blockquote>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			if err := md.Convert([]byte(input), &buf); err != nil {
-				b.Fatal(err)
-			}
+			c := qt.New(t)
+			c.Assert(buildEnvironmentTestParser().Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestEnvironmentDiagnostics(t *testing.T) {
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			extension.DefinitionList,
+			New(Config{Environments: []string{"align"}}),
+		),
+	)
+
+	// The definition ends before the \end, at the unindented line.
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"end in the next block",
+			"Term\n: \\begin{align}\n  a\n\n\\end{align}\n",
+			[]string{`2:3: passthrough crosses block boundary starting with "\\begin{align}"`},
+		},
+		{
+			"end after the next block",
+			"Term\n: \\begin{align}\n  a\n\nb\n\n\\end{align}\n",
+			[]string{`2:3: unclosed passthrough starting with "\\begin{align}"`},
+		},
+		{
+			"end after the blockquote",
+			"> \\begin{align}\n> a\n\n\\end{align}\n",
+			[]string{`1:3: passthrough crosses block boundary starting with "\\begin{align}"`},
+		},
+	} {
+		pc := parser.NewContext()
+		md.Parser().Parse(text.NewReader([]byte(test.input)), parser.WithContext(pc))
+		var diags []string
+		for _, d := range GetDiagnostics(pc) {
+			diags = append(diags, d.String())
 		}
-	})
+		c.Assert(diags, qt.DeepEquals, test.expected, qt.Commentf(test.name))
+	}
+}
+
+func TestEnvironmentNode(t *testing.T) {
+	input := `\begin{align*}
+a^*=x-b^*
+\end{align*}`
+
+	c := qt.New(t)
+	doc := buildEnvironmentTestParser().Parser().Parse(text.NewReader([]byte(input)))
+	block, ok := doc.FirstChild().(*PassthroughBlock)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(block.Environment, qt.Equals, "align*")
+	c.Assert(block.Delimiters.Open, qt.Equals, "\\begin{align*}")
+	c.Assert(block.Delimiters.Close, qt.Equals, "\\end{align*}")
+}
+
+func TestNested(t *testing.T) {
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{
+						{Open: "\\(", Close: "\\)", Nested: true},
+						{Open: "{{math}}", Close: "{{/math}}", Nested: true},
+						{Open: "[[", Close: "]]"},
+					},
+					BlockDelimiters: []Delimiters{
+						{Open: "{{display}}", Close: "{{/display}}", Nested: true},
+					},
+				},
+			)),
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"nested",
+			`a \(x \text{\(y_*\)} z_*\) b`,
+			`<p>a \(x \text{\(y_*\)} z_*\) b</p>`,
+		},
+		{
+			"escaped closer",
+			`a \(x \\) y_*\) b`,
+			`<p>a \(x \\) y_*\) b</p>`,
+		},
+		{
+			"across lines",
+			`a {{math}}x_*
+{{math}}y_*{{/math}}
+z_*{{/math}} b`,
+			`<p>a {{math}}x_*
+{{math}}y_*{{/math}}
+z_*{{/math}} b</p>`,
+		},
+		{
+			"not nested",
+			`a [[x [[y_*]] z_*]] b`,
+			`<p>a [[x [[y_<em>]] z_</em>]] b</p>`,
+		},
+		{
+			"unbalanced",
+			`a \(x \(y_*\) b_*`,
+			`<p>a (x \(y_*\) b_*</p>`,
+		},
+		{
+			"block",
+			`{{display}}
+{{display}}
+x_*
+{{/display}}
+y_*
+{{/display}}`,
+			`{{display}}
+{{display}}
+x_*
+{{/display}}
+y_*
+{{/display}}`,
+		},
+		{
+			"unclosed block before a block",
+			`{{display}} a_*
+
+{{display}} b_*
+
+{{/display}}`,
+			`<p>{{display}} a_*</p>
+{{display}} b_*
+
+{{/display}}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := qt.New(t)
+			c.Assert(md.Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestPandocConstraints(t *testing.T) {
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$", Constraints: PandocConstraints}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+				},
+			)),
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"math", `Inline $a^*=x-b^*$ equation`, `<p>Inline $a^*=x-b^*$ equation</p>`},
+		{"prices", `It costs $5 and *maybe* $10.`, `<p>It costs $5 and <em>maybe</em> $10.</p>`},
+		{"price range", `From $5-$10 or *more*`, `<p>From $5-$10 or <em>more</em></p>`},
+		{"price after math", `Then $x_*$ costs $5 *only*`, `<p>Then $x_*$ costs $5 <em>only</em></p>`},
+		{"closer followed by digit", `$x$5 and *y*$`, `<p>$x$5 and *y*$</p>`},
+		{"space after opener", `a $ x_* $ b_*`, `<p>a $ x_* $ b_*</p>`},
+		{"space before closer", `a $x_* $ *b*`, `<p>a $x_* $ <em>b</em></p>`},
+		{"shell variables", `Run echo $HOME and $PATH *now*`, `<p>Run echo $HOME and $PATH <em>now</em></p>`},
+		{"shell variables in code", "Run `echo $HOME $PATH` now", `<p>Run <code>echo $HOME $PATH</code> now</p>`},
+		{"across lines", "a $x_*\ny_*$ b", "<p>a $x_*\ny_*$ b</p>"},
+		{"closer at line start", "a $x_*\n$ b_*", "<p>a $x_*\n$ b_*</p>"},
+		{"block", "$$\nx_*\n$$", "$$\nx_*\n$$"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := qt.New(t)
+			c.Assert(md.Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := `# Title
+
+An equation: $a^*=x-b^* Amazing.
+
+Empty: \(\) and $x$.
+
+An equation: $a^
+
+*=x-b^*$. Amazing
+
+> $$
+> a^*=x-b^*
+
+$$
+
+\begin{align}
+a^*=x-b^*
+`
+
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}, {Open: "\\(", Close: "\\)"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+					Environments:     []string{"align"},
+				},
+			)),
+	)
+	pc := parser.NewContext()
+	md.Parser().Parse(text.NewReader([]byte(input)), parser.WithContext(pc))
+
+	var diags []string
+	for _, d := range GetDiagnostics(pc) {
+		diags = append(diags, d.String())
+	}
+	c.Assert(diags, qt.DeepEquals, []string{
+		`3:14: unclosed passthrough starting with "$"`,
+		`5:8: empty passthrough starting with "\\("`,
+		`7:14: passthrough crosses block boundary starting with "$"`,
+		`9:8: passthrough crosses block boundary starting with "$"`,
+		`11:3: passthrough crosses block boundary starting with "$$"`,
+		`14:1: unclosed passthrough starting with "$$"`,
+		`16:1: unclosed passthrough starting with "\\begin{align}"`,
+	})
+
+	diag := GetDiagnostics(pc)[0]
+	c.Assert(diag.Kind, qt.Equals, DiagnosticUnclosed)
+	c.Assert(diag.Offset, qt.Equals, strings.Index(input, "$a^*"))
+	c.Assert(diag.Delimiters.Open, qt.Equals, "$")
+}
+
+func TestDiagnosticsFollowingBlock(t *testing.T) {
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+				},
+			)),
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"closer in the next block",
+			"a $x\n\ny$ b",
+			[]string{
+				`1:3: passthrough crosses block boundary starting with "$"`,
+				`3:2: unclosed passthrough starting with "$"`,
+			},
+		},
+		{
+			"closer after the next block",
+			"a $x\n\nb\n\ny$ c",
+			[]string{
+				`1:3: unclosed passthrough starting with "$"`,
+				`5:2: unclosed passthrough starting with "$"`,
+			},
+		},
+		{
+			"math in the next block",
+			"a $x\n\n$y$ b",
+			[]string{`1:3: unclosed passthrough starting with "$"`},
+		},
+		{
+			"empty",
+			"a $$$$ b $x$",
+			[]string{`1:3: empty passthrough starting with "$$"`},
+		},
+	} {
+		pc := parser.NewContext()
+		md.Parser().Parse(text.NewReader([]byte(test.input)), parser.WithContext(pc))
+		var diags []string
+		for _, d := range GetDiagnostics(pc) {
+			diags = append(diags, d.String())
+		}
+		c.Assert(diags, qt.DeepEquals, test.expected, qt.Commentf(test.name))
+	}
+
+	var buf bytes.Buffer
+	c.Assert(md.Convert([]byte("a $$$$ b"), &buf), qt.IsNil)
+	c.Assert(buf.String(), qt.Equals, "<p>a $$$$ b</p>\n")
+}
+
+func TestBlockAttributes(t *testing.T) {
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}},
+					BlockDelimiters: []Delimiters{
+						{Open: "$$", Close: "$$"},
+						{Open: "\\[", Close: "\\]", Output: Output{Element: "div", Class: "math display", StripDelimiters: true}},
+					},
+					Environments:     []string{"align"},
+					FencedCodeBlocks: []string{"math"},
+					Attributes:       true,
+				},
+			)),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"single line",
+			`$$ E=mc^2 $$ {#eq:energy .numbered}`,
+			`<div class="numbered" id="eq:energy">$$ E=mc^2 $$</div>`,
+		},
+		{
+			"multiple lines",
+			`$$
+E=mc^2
+$$ {#eq:energy data-number=1}`,
+			`<div id="eq:energy" data-number="1">$$
+E=mc^2
+$$</div>`,
+		},
+		{
+			"output class",
+			`\[E=mc^2\] {#eq:energy .numbered}`,
+			`<div class="math display numbered" id="eq:energy">E=mc^2</div>`,
+		},
+		{
+			"mid paragraph",
+			`Energy $$E=mc^2$$ {#eq:energy} is *conserved*.`,
+			`<p>Energy </p>
+<div id="eq:energy">$$E=mc^2$$</div>
+<p> is <em>conserved</em>.</p>`,
+		},
+		{
+			"end of paragraph",
+			`Energy $$E=mc^2$$ {#eq:energy}`,
+			`<p>Energy </p>
+<div id="eq:energy">$$E=mc^2$$</div>`,
+		},
+		{
+			"environment",
+			`\begin{align}
+E=mc^2
+\end{align} {#eq:energy}`,
+			`<div id="eq:energy">\begin{align}
+E=mc^2
+\end{align}</div>`,
+		},
+		{
+			"not attributes",
+			`$$ E=mc^2 $$ {not attributes}`,
+			`$$ E=mc^2 $$
+<p> {not attributes}</p>`,
+		},
+		{
+			"heading id",
+			`$$ E=mc^2 $$ {#energy}
+
+# Energy`,
+			`<div id="energy">$$ E=mc^2 $$</div>
+<h1 id="energy-1">Energy</h1>`,
+		},
+		{
+			"heading id mid paragraph",
+			`Energy $$ E=mc^2 $$ {#energy} is conserved.
+
+# Energy`,
+			`<p>Energy </p>
+<div id="energy">$$ E=mc^2 $$</div>
+<p> is conserved.</p>
+<h1 id="energy-1">Energy</h1>`,
+		},
+		{
+			"heading id fenced",
+			"```math {#energy}\nE=mc^2\n```\n\n# Energy",
+			`<div id="energy">$$
+E=mc^2
+$$</div>
+<h1 id="energy-1">Energy</h1>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := qt.New(t)
+			c.Assert(md.Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestEquationNumbering(t *testing.T) {
+	input := `See [@eq:energy] and [@eq:missing], [@eq:pythagoras].
+
+$$ E=mc^2 $$ {#eq:energy}
+
+$$ x $$
+
+Text $$a^2+b^2=c^2$$ {#eq:pythagoras} [link](/a) and [@ not a reference].
+
+As in LaTeX, \eqref{eq:energy}, \eqref{eq:missing} and \eqref{not a reference}.
+
+A [link to [@eq:energy]](/b) and \@eq:energy].`
+	expected := `<p>See <a href="#eq:energy">(1)</a> and [@eq:missing], <a href="#eq:pythagoras">(2)</a>.</p>
+<div id="eq:energy">$$ E=mc^2 $$</div>
+$$ x $$
+<p>Text </p>
+<div id="eq:pythagoras">$$a^2+b^2=c^2$$</div>
+<p> <a href="/a">link</a> and [@ not a reference].</p>
+<p>As in LaTeX, <a href="#eq:energy">(1)</a>, \eqref{eq:missing} and \eqref{not a reference}.</p>
+<p>A <a href="/b">link to (1)</a> and @eq:energy].</p>`
+
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					BlockDelimiters:   []Delimiters{{Open: "$$", Close: "$$"}},
+					EquationNumbering: true,
+				},
+			)),
+	)
+	pc := parser.NewContext()
+	var buf bytes.Buffer
+	c.Assert(md.Convert([]byte(input), &buf, parser.WithContext(pc)), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, expected)
+	c.Assert(GetEquationNumbers(pc), qt.DeepEquals, map[string]int{"eq:energy": 1, "eq:pythagoras": 2})
+
+	var diags []string
+	for _, d := range GetDiagnostics(pc) {
+		diags = append(diags, d.String())
+	}
+	c.Assert(diags, qt.DeepEquals, []string{
+		`1:22: unresolved equation reference "eq:missing"`,
+		`9:33: unresolved equation reference "eq:missing"`,
+	})
+}
+
+func TestEquationNumberingLinks(t *testing.T) {
+	input := `$$ E=mc^2 $$ {#eq:energy}
+
+See [@john](https://x.com/john), [@ref], [@full][ref] and [@eq:energy].
+
+[@ref]: https://x.com/ref
+[ref]: https://x.com/full`
+	expected := `<div id="eq:energy">$$ E=mc^2 $$</div>
+<p>See <a href="https://x.com/john">@john</a>, <a href="https://x.com/ref">@ref</a>, <a href="https://x.com/full">@full</a> and <a href="#eq:energy">(1)</a>.</p>`
+
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					BlockDelimiters:   []Delimiters{{Open: "$$", Close: "$$"}},
+					EquationNumbering: true,
+				},
+			)),
+	)
+	pc := parser.NewContext()
+	var buf bytes.Buffer
+	c.Assert(md.Convert([]byte(input), &buf, parser.WithContext(pc)), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, expected)
+	c.Assert(GetDiagnostics(pc), qt.HasLen, 0)
+}
+
+func TestEquationNumberingDisabled(t *testing.T) {
+	input := `See [@eq:energy].
+
+$$ E=mc^2 $$ {#eq:energy}`
+	expected := `<p>See [@eq:energy].</p>
+$$ E=mc^2 $$
+<p> {#eq:energy}</p>`
+	actual := Parse(t, input)
+
+	c := qt.New(t)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+type testRenderer struct{}
+
+func (r testRenderer) RenderInline(w util.BufWriter, ctx RenderContext) error {
+	if ctx.Delimiters.Open == "\\(" {
+		return ErrUseDefault
+	}
+	fmt.Fprintf(w, "<math display=%t>%s</math>", ctx.Display, ctx.Content)
+	return nil
+}
+
+func (r testRenderer) RenderBlock(w util.BufWriter, ctx RenderContext) error {
+	if bytes.Contains(ctx.Content, []byte("error")) {
+		return errors.New("render failed")
+	}
+	fmt.Fprintf(w, "<math display=%t>%s</math>\n", ctx.Display, ctx.Content)
+	return nil
+}
+
+func parseWithRenderer(t *testing.T, input string) (string, error) {
+	t.Helper()
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}, {Open: "\\(", Close: "\\)"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+					Renderer:         testRenderer{},
+				},
+			)),
+	)
+	var buf bytes.Buffer
+	err := md.Convert([]byte(input), &buf)
+	return strings.TrimSpace(buf.String()), err
+}
+
+func TestRenderer(t *testing.T) {
+	input := `Inline $a^*$ and \(b^*\)
+
+$$
+c^*
+$$
+
+# Heading $$d^*$$`
+	expected := `<p>Inline <math display=false>a^*</math> and \(b^*\)</p>
+<math display=true>
+c^*
+</math>
+<h1>Heading <math display=true>d^*</math></h1>`
+
+	c := qt.New(t)
+	actual, err := parseWithRenderer(t, input)
+	c.Assert(err, qt.IsNil)
+	c.Assert(actual, qt.Equals, expected)
+}
+
+func TestRendererError(t *testing.T) {
+	c := qt.New(t)
+	_, err := parseWithRenderer(t, "$$error$$")
+	c.Assert(err, qt.ErrorMatches, "render failed")
+}
+
+func BenchmarkWithAndWithoutPassthrough(b *testing.B) {
+	const input = `
+## Block
+
+$$
+a^*=x-b^*
+$$
+
+## Inline
+
+Inline $a^*=x-b^*$ equation.`
+
+	b.Run("without passthrough", func(b *testing.B) {
+		md := goldmark.New()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			if err := md.Convert([]byte(input), &buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("with passthrough", func(b *testing.B) {
+		md := buildTestParser()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			if err := md.Convert([]byte(input), &buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkLongParagraph(b *testing.B) {
+	// Each line starts with a block opener, so the block parser checks the
+	// paragraph for an unclosed passthrough on every line.
+	for _, n := range []int{1000, 8000} {
+		input := []byte(strings.Repeat("$$a$$ b\n", n))
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			md := buildTestParser()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var buf bytes.Buffer
+				if err := md.Convert(input, &buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUnclosedBlocks(b *testing.B) {
+	// Each block opener looks for a closer in the rest of the document.
+	for _, n := range []int{1000, 8000} {
+		input := []byte(strings.Repeat("\\[ a\n\n", n))
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			md := buildTestParser()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var buf bytes.Buffer
+				if err := md.Convert(input, &buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestInventory(t *testing.T) {
+	input := `# Title $x$
+
+Inline $a^*$ and \(b^*\), block $$c^*$$ in a paragraph.
+
+$$
+d^*
+$$
+
+\begin{align}
+e^*
+\end{align}
+
+` + "```math\nf^*\n```\n\n```math\n```"
+
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$", Name: "math"}, {Open: "\\(", Close: "\\)", Name: "math"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$", Name: "display"}},
+					Environments:     []string{"align"},
+					FencedCodeBlocks: []string{"math"},
+				},
+			)),
+	)
+	source := []byte(input)
+	pc := parser.NewContext()
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+
+	inv := GetInventory(pc)
+	c.Assert(inv.Inline, qt.Equals, 3)
+	c.Assert(inv.Block, qt.Equals, 5)
+	c.Assert(inv.Len(), qt.Equals, 8)
+	c.Assert(inv.Names(), qt.DeepEquals, []string{"display", "math"})
+
+	var got []string
+	for _, e := range inv.Entries {
+		if b, ok := e.Node.(*PassthroughBlock); ok && b.Fence != "" {
+			got = append(got, fmt.Sprintf("fenced %q", source[e.Start:e.Stop]))
+			continue
+		}
+		c.Assert(string(source[e.Start:e.Stop]), qt.Equals, e.Delimiters.Open+string(e.Content)+e.Delimiters.Close)
+		got = append(got, fmt.Sprintf("%s %q", e.Node.Kind(), e.Content))
+	}
+	c.Assert(got, qt.DeepEquals, []string{
+		`PassthroughInline "x"`,
+		`PassthroughInline "a^*"`,
+		`PassthroughInline "b^*"`,
+		`PassthroughBlock "c^*"`,
+		`PassthroughBlock "\nd^*\n"`,
+		`PassthroughBlock "\ne^*\n"`,
+		"fenced \"```math\\nf^*\\n```\"",
+		"fenced \"```math\\n```\"",
+	})
+
+	fromDoc := NewInventory(doc, source)
+	c.Assert(fromDoc.Len(), qt.Equals, inv.Len())
+	for i, e := range fromDoc.Entries {
+		c.Assert(e.Node, qt.Equals, inv.Entries[i].Node)
+	}
+	c.Assert(GetInventory(parser.NewContext()).Len(), qt.Equals, 0)
+}
+
+func TestPositions(t *testing.T) {
+	input := `# Title $x$
+
+Inline \(a
++b\) and $$c$$.
+
+$$
+d
+$$
+
+` + "```math\ne\n```\n\n> ~~~math\n> ~~~\n\n```math\nf"
+
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}, {Open: "\\(", Close: "\\)"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+					FencedCodeBlocks: []string{"math"},
+				},
+			)),
+	)
+	doc := md.Parser().Parse(text.NewReader([]byte(input)))
+
+	var got []string
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *PassthroughInline:
+			got = append(got, fmt.Sprintf("inline %s-%s", n.Start, n.End))
+		case *PassthroughBlock:
+			got = append(got, fmt.Sprintf("block %s-%s", n.Start, n.End))
+		}
+		return ast.WalkContinue, nil
+	})
+	c.Assert(got, qt.DeepEquals, []string{
+		"inline 1:9-1:12",
+		"inline 3:8-4:5",
+		"block 4:10-4:15",
+		"block 6:1-8:3",
+		"block 10:1-12:4",
+		"block 14:3-15:6",
+		"block 17:1-18:2",
+	})
+
+	c.Assert(Position{}.IsValid(), qt.IsFalse)
+	c.Assert(newLineIndex([]byte("a\n\nb")).position(3), qt.Equals, Position{Line: 3, Column: 1})
+}
+
+// coreTestRenderer renders the core nodes used in the Markdown and plain
+// text tests.
+type coreTestRenderer struct{}
+
+func (r coreTestRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindDocument, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		return ast.WalkContinue, nil
+	})
+	reg.Register(ast.KindParagraph, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			_ = w.WriteByte('\n')
+		}
+		return ast.WalkContinue, nil
+	})
+	reg.Register(ast.KindTextBlock, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			_ = w.WriteByte('\n')
+		}
+		return ast.WalkContinue, nil
+	})
+	// Block quotes and list items only write the prefix of their first
+	// line, and are expected to hold a single block.
+	reg.Register(ast.KindBlockquote, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("> ")
+		}
+		return ast.WalkContinue, nil
+	})
+	reg.Register(ast.KindListItem, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("- ")
+		}
+		return ast.WalkContinue, nil
+	})
+	reg.Register(ast.KindText, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			t := n.(*ast.Text)
+			_, _ = w.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() {
+				_ = w.WriteByte('\n')
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func TestMarkdownRenderer(t *testing.T) {
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters:  []Delimiters{{Open: "$", Close: "$"}, {Open: "\\(", Close: "\\)"}},
+					BlockDelimiters:   []Delimiters{{Open: "$$", Close: "$$"}, {Open: "\\[", Close: "\\]"}},
+					Environments:      []string{"align"},
+					FencedCodeBlocks:  []string{"math"},
+					EquationNumbering: true,
+				},
+			)),
+		goldmark.WithRenderer(renderer.NewRenderer(renderer.WithNodeRenderers(
+			util.Prioritized(coreTestRenderer{}, 1000),
+			util.Prioritized(NewMarkdownRenderer(), 10),
+		))),
+	)
+
+	for _, input := range []string{
+		"Inline $a^*$ and \\(b^*\\) in\na paragraph with $c\nd$ over lines.\n",
+		"$$\na^*=x-b^*\n$$\n",
+		"\\[a^*=x-b^*\\]\n",
+		"$$ E=mc^2 $$ {#eq:energy .numbered .important}\n",
+		"$$\nE=mc^2\n$$ {#eq:energy data-number=1}\n",
+		"$$ x $$ {data-values=[1, 2.5, \"a\", true, null]}\n",
+		"\\begin{align}\na &= b\n\\end{align}\n",
+		"See [@eq:missing].\n",
+		"See \\eqref{eq:missing}.\n",
+		"```math {#eq:fenced}\na^*\n```\n",
+		"````math\na^*\n```\n````\n",
+		"> $$\n> a^*\n> $$ {#eq:quoted}\n",
+		"- $$\n  a^*\n  $$\n",
+		"> - Inline $a\n>   b$ and \\(c\n>   d\\)\n",
+		"> ```math\n> a^*\n> ```\n",
+		"- ```math\n  a^*\n  ```\n",
+	} {
+		var buf bytes.Buffer
+		c.Assert(md.Convert([]byte(input), &buf), qt.IsNil)
+		c.Assert(buf.String(), qt.Equals, input)
+	}
+}
+
+func TestPlainTextRenderer(t *testing.T) {
+	input := `See [@eq:energy] and $a^*$.
+
+$$
+E=mc^2
+$$ {#eq:energy}
+`
+
+	c := qt.New(t)
+	for _, test := range []struct {
+		conf     PlainTextConfig
+		expected string
+	}{
+		{PlainTextConfig{}, "See (1) and $a^*$.\n$$\nE=mc^2\n$$\n"},
+		{PlainTextConfig{StripDelimiters: true}, "See (1) and a^*.\nE=mc^2\n"},
+		{PlainTextConfig{Placeholder: "[math]"}, "See (1) and [math].\n[math]\n"},
+	} {
+		md := goldmark.New(
+			goldmark.WithExtensions(
+				New(
+					Config{
+						InlineDelimiters:  []Delimiters{{Open: "$", Close: "$"}},
+						BlockDelimiters:   []Delimiters{{Open: "$$", Close: "$$"}},
+						EquationNumbering: true,
+					},
+				)),
+			goldmark.WithRenderer(renderer.NewRenderer(renderer.WithNodeRenderers(
+				util.Prioritized(coreTestRenderer{}, 1000),
+				util.Prioritized(NewPlainTextRenderer(test.conf), 10),
+			))),
+		)
+		var buf bytes.Buffer
+		c.Assert(md.Convert([]byte(input), &buf), qt.IsNil)
+		c.Assert(buf.String(), qt.Equals, test.expected)
+	}
+}
+
+func buildTableTestParser(table goldmark.Extender, extensions ...goldmark.Extender) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(
+			append(extensions, New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}, {Open: "\\(", Close: "\\)"}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+					Table:            table,
+				},
+			))...),
+	)
+}
+
+func TestTables(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"pipes in inline math",
+			`| a | b |
+|---|---|
+| $|x|$ | $\{a \mid b\}$ |`,
+			`<table>
+<thead>
+<tr>
+<th>a</th>
+<th>b</th>
+</tr>
+</thead>
+<tbody>
+<tr>
+<td>$|x|$</td>
+<td>$\{a \mid b\}$</td>
+</tr>
+</tbody>
+</table>`,
+		},
+		{
+			"pipes in header and block delimiters",
+			`| \(|x|\) | $$|y|$$ |
+|---|---|
+| c | d |`,
+			`<table>
+<thead>
+<tr>
+<th>\(|x|\)</th>
+<th>$$|y|$$</th>
+</tr>
+</thead>
+<tbody>
+<tr>
+<td>c</td>
+<td>d</td>
+</tr>
+</tbody>
+</table>`,
+		},
+		{
+			"paragraph before table",
+			`Intro $|x|$
+| a |
+|---|
+| $|x|$ |`,
+			`<p>Intro $|x|$</p>
+<table>
+<thead>
+<tr>
+<th>a</th>
+</tr>
+</thead>
+<tbody>
+<tr>
+<td>$|x|$</td>
+</tr>
+</tbody>
+</table>`,
+		},
+		{
+			"escaped and code span delimiters",
+			"| a | b | c |\n|---|---|---|\n| \\$ | `$` | $|$ |",
+			`<table>
+<thead>
+<tr>
+<th>a</th>
+<th>b</th>
+<th>c</th>
+</tr>
+</thead>
+<tbody>
+<tr>
+<td>$</td>
+<td><code>$</code></td>
+<td>$|$</td>
+</tr>
+</tbody>
+</table>`,
+		},
+		{
+			"not a table",
+			`Inline $|x|$ and $a|b$`,
+			`<p>Inline $|x|$ and $a|b$</p>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := qt.New(t)
+			c.Assert(buildTableTestParser(extension.Table).Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+
+			// Also registering the table extension with goldmark changes
+			// nothing.
+			buf.Reset()
+			c.Assert(buildTableTestParser(extension.Table, extension.Table).Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestTablesDisabled(t *testing.T) {
+	input := `| a |
+|---|
+| $|x|$ |`
+
+	var buf bytes.Buffer
+	c := qt.New(t)
+	c.Assert(buildTableTestParser(nil, extension.Table).Convert([]byte(input), &buf), qt.IsNil)
+	c.Assert(buf.String(), qt.Contains, `<td>$</td>`)
+
+	// Without the table extension, there are no tables.
+	buf.Reset()
+	c.Assert(buildTableTestParser(nil).Convert([]byte(input), &buf), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, "<p>| a |\n|---|\n| $|x|$ |</p>")
+}
+
+func TestFencedCodeBlocks(t *testing.T) {
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}},
+					BlockDelimiters: []Delimiters{
+						{Open: "$$", Close: "$$", Output: Output{Element: "div", Class: "math"}},
+					},
+					FencedCodeBlocks:  []string{"math", "latex"},
+					EquationNumbering: true,
+				},
+			)),
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"math",
+			"```math\na^*=x-b^*\n```",
+			`<div class="math">$$
+a^*=x-b^*
+$$</div>
+`,
+		},
+		{
+			"latex in blockquote",
+			"> ~~~latex\n> a^*\n> b^*\n> ~~~",
+			`<blockquote>
+<div class="math">$$
+a^*
+b^*
+$$</div>
+</blockquote>
+`,
+		},
+		{
+			"attributes",
+			"```math {#eq:a}\na^*\n```\n\nSee [@eq:a].",
+			`<div class="math" id="eq:a">$$
+a^*
+$$</div>
+<p>See <a href="#eq:a">(1)</a>.</p>
+`,
+		},
+		{
+			"other language",
+			"```go\na^*\n```",
+			`<pre><code class="language-go">a^*
+</code></pre>
+`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := qt.New(t)
+			c.Assert(md.Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(buf.String(), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestDollarBacktick(t *testing.T) {
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$", Name: "math", Output: Output{Element: "span", Class: "math"}}},
+					BlockDelimiters:  []Delimiters{{Open: "$$", Close: "$$"}},
+					DollarBacktick:   true,
+				},
+			)),
+	)
+
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"basic",
+			"Inline $`a^*=x-b^*`$ math",
+			`<p>Inline <span class="math">$` + "`a^*=x-b^*`" + `$</span> math</p>`,
+		},
+		{
+			"longer backtick run",
+			"$``a`b^*``$ and $``c``$",
+			`<p><span class="math">$` + "``a`b^*``" + `$</span> and <span class="math">$` + "``c``" + `$</span></p>`,
+		},
+		{
+			"across lines",
+			"> $`a^*=\n> x-b^*`$",
+			`<blockquote>
+<p><span class="math">$` + "`a^*=\nx-b^*`" + `$</span></p>
+</blockquote>`,
+		},
+		{
+			"unclosed",
+			"A $`code` span and $x$",
+			"<p>A $`code` span and <span class=\"math\">$x$</span></p>",
+		},
+		{
+			"mismatched backtick run is text",
+			"$``a^*`$ b",
+			"<p>$``a^*`$ b</p>",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := qt.New(t)
+			c.Assert(md.Convert([]byte(test.input), &buf), qt.IsNil)
+			c.Assert(strings.TrimSpace(buf.String()), qt.Equals, test.expected)
+		})
+	}
+}
+
+func TestDollarBacktickRenderer(t *testing.T) {
+	c := qt.New(t)
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			New(
+				Config{
+					InlineDelimiters: []Delimiters{{Open: "$", Close: "$"}},
+					DollarBacktick:   true,
+					Renderer:         testRenderer{},
+				},
+			)),
+	)
+	var buf bytes.Buffer
+	c.Assert(md.Convert([]byte("Inline $``a`b``$"), &buf), qt.IsNil)
+	c.Assert(strings.TrimSpace(buf.String()), qt.Equals, "<p>Inline <math display=false>a`b</math></p>")
 }
@@ -0,0 +1,79 @@
+package passthrough
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// PlainTextConfig configures the plain text renderer.
+type PlainTextConfig struct {
+	// StripDelimiters writes passthroughs without their delimiters.
+	StripDelimiters bool
+
+	// Placeholder, if set, is written instead of each passthrough, e.g.
+	// "[math]".
+	Placeholder string
+}
+
+// NewPlainTextRenderer returns a renderer.NodeRenderer that renders the nodes
+// of this package as plain text, e.g. for search indexes and summaries.
+// Passthroughs are written as their text, and resolved equation references
+// as their number in parentheses.
+func NewPlainTextRenderer(c PlainTextConfig) renderer.NodeRenderer {
+	return &plainTextRenderer{PlainTextConfig: c}
+}
+
+type plainTextRenderer struct {
+	PlainTextConfig
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *plainTextRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindPassthroughInline, r.renderInline)
+	reg.Register(KindPassthroughBlock, r.renderBlock)
+	reg.Register(KindEquationReference, r.renderEquationReference)
+}
+
+func (r *plainTextRenderer) renderInline(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		inline := n.(*PassthroughInline)
+		r.write(w, inline.Value(source), inline.Delimiters)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *plainTextRenderer) renderBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		block := n.(*PassthroughBlock)
+		r.write(w, block.Value(source), block.Delimiters)
+		_ = w.WriteByte('\n')
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *plainTextRenderer) write(w util.BufWriter, value []byte, d *Delimiters) {
+	if r.Placeholder != "" {
+		_, _ = w.WriteString(r.Placeholder)
+		return
+	}
+	if r.StripDelimiters {
+		value = bytes.TrimSpace(trimDelimiters(value, d))
+	}
+	_, _ = w.Write(bytes.TrimSuffix(value, []byte("\n")))
+}
+
+func (r *plainTextRenderer) renderEquationReference(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		ref := n.(*EquationReference)
+		if ref.Number == 0 {
+			_, _ = w.Write(ref.Segment.Value(source))
+		} else {
+			_, _ = w.WriteString("(" + strconv.Itoa(ref.Number) + ")")
+		}
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,109 @@
+package passthrough
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Position is a location in the source.
+type Position struct {
+	// Line and Column are 1-based. Column counts bytes. Both are 0 if the
+	// position is unknown.
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position formatted as "line:column".
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// lineIndex holds the offsets of the starts of the lines in a source.
+type lineIndex []int
+
+func newLineIndex(source []byte) lineIndex {
+	index := lineIndex{0}
+	for i := 0; ; {
+		j := bytes.IndexByte(source[i:], '\n')
+		if j < 0 {
+			return index
+		}
+		i += j + 1
+		index = append(index, i)
+	}
+}
+
+// position returns the position of offset.
+func (l lineIndex) position(offset int) Position {
+	line := sort.Search(len(l), func(i int) bool { return l[i] > offset }) - 1
+	return Position{Line: line + 1, Column: offset - l[line] + 1}
+}
+
+var lineIndexKey = parser.NewContextKey()
+
+// getLineIndex returns the line index of source, which is built once per
+// document and kept in pc.
+func getLineIndex(pc parser.Context, source []byte) lineIndex {
+	if index, ok := pc.Get(lineIndexKey).(lineIndex); ok {
+		return index
+	}
+	index := newLineIndex(source)
+	pc.Set(lineIndexKey, index)
+	return index
+}
+
+// span returns the byte offsets of a passthrough node, including its
+// delimiters, in the source.
+func span(n ast.Node) (start, stop int, ok bool) {
+	switch n := n.(type) {
+	case *PassthroughInline:
+		return n.Segment.Start, n.Segment.Stop, true
+	case *PassthroughBlock:
+		if n.Fence != "" {
+			// The lines of a fenced block hold its content only.
+			return n.fenceSegment.Start, n.fenceSegment.Stop, true
+		}
+		lines := n.Lines()
+		if lines.Len() == 0 {
+			return 0, 0, false
+		}
+		return lines.At(0).Start, lines.At(lines.Len() - 1).Stop, true
+	}
+	return 0, 0, false
+}
+
+// positionTransformer sets the positions of the passthrough nodes. It runs
+// after the transformers that create passthrough blocks.
+type positionTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *positionTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	index := getLineIndex(pc, reader.Source())
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		start, stop, ok := span(n)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *PassthroughInline:
+			n.Start, n.End = index.position(start), index.position(stop)
+		case *PassthroughBlock:
+			n.Start, n.End = index.position(start), index.position(stop)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
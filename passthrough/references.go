@@ -0,0 +1,196 @@
+package passthrough
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// EquationReference is an inline node representing a reference, such as
+// [@eq:energy] or \eqref{eq:energy}, to a numbered passthrough block.
+type EquationReference struct {
+	ast.BaseInline
+
+	// The segment of text that this reference represents, including the
+	// brackets or the \eqref command.
+	Segment text.Segment
+
+	// The referenced id.
+	ID []byte
+
+	// The number of the referenced block, or 0 if the reference is
+	// unresolved.
+	Number int
+}
+
+// KindEquationReference is a NodeKind of the EquationReference node.
+var KindEquationReference = ast.NewNodeKind("EquationReference")
+
+// Kind implements Node.Kind.
+func (n *EquationReference) Kind() ast.NodeKind {
+	return KindEquationReference
+}
+
+// Dump implements Node.Dump.
+func (n *EquationReference) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"ID":     string(n.ID),
+		"Number": strconv.Itoa(n.Number),
+	}, nil)
+}
+
+var equationNumbersKey = parser.NewContextKey()
+
+// GetEquationNumbers returns the numbers assigned to passthrough blocks,
+// keyed by id, while parsing a document with the given context. Pass the
+// context to the parser with parser.WithContext.
+func GetEquationNumbers(pc parser.Context) map[string]int {
+	numbers, _ := pc.Get(equationNumbersKey).(map[string]int)
+	return numbers
+}
+
+type equationReferenceParser struct{}
+
+func newEquationReferenceParser() parser.InlineParser {
+	return &equationReferenceParser{}
+}
+
+// Trigger implements parser.InlineParser.
+func (s *equationReferenceParser) Trigger() []byte {
+	return []byte{'[', '\\'}
+}
+
+// eqrefCommand starts a reference written as in LaTeX, \eqref{eq:energy}.
+var eqrefCommand = []byte(`\eqref{`)
+
+// Parse implements parser.InlineParser.
+func (s *equationReferenceParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if bytes.HasPrefix(line, eqrefCommand) {
+		end := bytes.IndexByte(line, '}')
+		if end < 0 {
+			return nil
+		}
+		id := line[len(eqrefCommand):end]
+		if len(id) == 0 || bytes.ContainsAny(id, " \t\r\n{\\") {
+			return nil
+		}
+		block.Advance(end + 1)
+		return &EquationReference{
+			Segment: segment.WithStop(segment.Start + end + 1),
+			ID:      id,
+		}
+	}
+	if len(line) < 4 || line[0] != '[' || line[1] != '@' {
+		return nil
+	}
+	end := bytes.IndexByte(line, ']')
+	if end < 3 {
+		return nil
+	}
+	id := line[2:end]
+	if bytes.ContainsAny(id, " \t\r\n[@") {
+		return nil
+	}
+	// Leave links such as [@john](url), [@john][ref] and [@john] with a
+	// matching link reference definition to the link parser.
+	if end+1 < len(line) && (line[end+1] == '(' || line[end+1] == '[') {
+		return nil
+	}
+	if _, ok := pc.Reference(util.ToLinkReference(line[1:end])); ok {
+		return nil
+	}
+	block.Advance(end + 1)
+	return &EquationReference{
+		Segment: segment.WithStop(segment.Start + end + 1),
+		ID:      id,
+	}
+}
+
+// equationNumberingTransformer numbers the passthrough blocks that have an id
+// attribute in document order, and resolves the equation references.
+type equationNumberingTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *equationNumberingTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	numbers := map[string]int{}
+	var refs []*EquationReference
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *PassthroughBlock:
+			if id, ok := n.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					if _, found := numbers[string(id)]; !found {
+						n.Number = len(numbers) + 1
+						numbers[string(id)] = n.Number
+					}
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *EquationReference:
+			refs = append(refs, n)
+		}
+		return ast.WalkContinue, nil
+	})
+	pc.Set(equationNumbersKey, numbers)
+
+	for _, ref := range refs {
+		ref.Number = numbers[string(ref.ID)]
+		if ref.Number == 0 {
+			appendDiagnostic(pc, reader.Source(), Diagnostic{
+				Kind:   DiagnosticUnresolvedReference,
+				ID:     string(ref.ID),
+				Offset: ref.Segment.Start,
+			})
+		}
+	}
+}
+
+type equationReferenceRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *equationReferenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindEquationReference, r.renderEquationReference)
+}
+
+// renderEquationReference renders a resolved reference as a link to the
+// block, or as its number alone inside the text of another link, and an
+// unresolved reference as the original text.
+func (r *equationReferenceRenderer) renderEquationReference(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	ref := n.(*EquationReference)
+	if ref.Number == 0 {
+		_, _ = w.Write(util.EscapeHTML(ref.Segment.Value(source)))
+		return ast.WalkContinue, nil
+	}
+	if inLink(n) {
+		_, _ = fmt.Fprintf(w, "(%d)", ref.Number)
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<a href="#`)
+	_, _ = w.Write(util.EscapeHTML(util.URLEscape(ref.ID, false)))
+	_, _ = fmt.Fprintf(w, `">(%d)</a>`, ref.Number)
+	return ast.WalkContinue, nil
+}
+
+// inLink reports whether n is in the text of a link, where HTML doesn't
+// allow another link.
+func inLink(n ast.Node) bool {
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Kind() == ast.KindLink || p.Kind() == ast.KindAutoLink {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package passthrough
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// pipeMask replaces the pipes inside passthroughs in the copy of the source
+// that the table transformer splits rows on. It is neither a pipe nor a
+// space, so it changes neither the cell boundaries nor their trimming.
+const pipeMask = '_'
+
+// tableParagraphTransformer turns paragraphs into GFM tables like goldmark's
+// table extension, but without splitting cells on the pipes inside
+// passthroughs. It must run before the table extension's transformer, which
+// then only sees the paragraphs that are left.
+type tableParagraphTransformer struct {
+	delims []Delimiters
+}
+
+func newTableParagraphTransformer(delims []Delimiters) parser.ParagraphTransformer {
+	return &tableParagraphTransformer{delims: delims}
+}
+
+func (t *tableParagraphTransformer) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var masked []byte
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		line := seg.Value(source)
+		for _, span := range passthroughSpans(t.delims, line) {
+			for j := span[0]; j < span[1]; j++ {
+				if line[j] != '|' {
+					continue
+				}
+				if masked == nil {
+					masked = make([]byte, len(source))
+					copy(masked, source)
+				}
+				masked[seg.Start+j] = pipeMask
+			}
+		}
+	}
+	if masked == nil {
+		return
+	}
+	// The masked source has the same length as the original, so the
+	// segments of the table cells are valid in both.
+	extension.NewTableParagraphTransformer().Transform(node, text.NewReader(masked), pc)
+}
+
+// passthroughSpans returns the start and stop offsets of the passthroughs in
+// a line, including their delimiters. It follows the scanning rules of
+// inlinePassthroughParser.Parse, and skips code spans and backslash-escaped
+// punctuation as the inline parser does.
+func passthroughSpans(delims []Delimiters, b []byte) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(b); i++ {
+		if d := getFullOpeningDelimiter(delims, b[i:]); d != nil {
+			closingDelimiterPos, _ := d.closingDelimiterIndex(b[i+len(d.Open):], 0)
+			if closingDelimiterPos > 0 {
+				stop := i + len(d.Open) + closingDelimiterPos + len(d.Close)
+				spans = append(spans, [2]int{i, stop})
+				i = stop - 1
+			}
+			continue
+		}
+		switch b[i] {
+		case '\\':
+			if i+1 < len(b) && b[i+1] == '\\' {
+				if d := getFullOpeningDelimiter(delims, b[i+2:]); d != nil {
+					i += 1 + len(d.Open)
+					continue
+				}
+			}
+			if i+1 < len(b) && util.IsPunct(b[i+1]) {
+				i++
+			}
+		case '`':
+			i = skipCodeSpan(b, i)
+		}
+	}
+	return spans
+}
+
+// skipCodeSpan returns the offset of the last backtick of the code span that
+// starts at b[i], or of the last backtick of the opening run if the span is
+// not closed on this line.
+func skipCodeSpan(b []byte, i int) int {
+	n := 0
+	for i+n < len(b) && b[i+n] == '`' {
+		n++
+	}
+	for j := i + n; j < len(b); {
+		if b[j] != '`' {
+			j++
+			continue
+		}
+		m := 0
+		for j+m < len(b) && b[j+m] == '`' {
+			m++
+		}
+		if m == n {
+			return j + m - 1
+		}
+		j += m
+	}
+	return i + n - 1
+}